@@ -0,0 +1,163 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Outcome represents the outcome of an event reported to an AdaptiveLimiter.
+type Outcome int
+
+const (
+	// Success means the event succeeded in time, so the rate can grow.
+	Success Outcome = iota
+	// Overload means the event failed or timed out because the downstream is overloaded, so the rate must shrink.
+	Overload
+)
+
+// Adaptation represents how an AdaptiveLimiter adapts its rate to the outcomes of events.
+type Adaptation struct {
+	MinRate          Rate          // The floor of the rate. Default is one event per period of MaxRate.
+	MaxRate          Rate          // The ceiling of the rate. The rate does not adapt if it is zero.
+	Increase         int           // The number of events per period of MaxRate added to the rate on each success. Default is 1.
+	DecreaseFactor   float64       // The factor the rate is multiplied by on overload, between 0 and 1. Default is 0.5.
+	LatencyThreshold time.Duration // Reported latencies above it count as overload. Zero means latencies always count as success.
+	Cooldown         time.Duration // The minimum time between two decreases, so overload signals from the same incident only decrease the rate once. Default is one second.
+}
+
+// normalizeAdaptation applies the defaults of the options of an adaptation.
+func normalizeAdaptation(adaptation Adaptation) Adaptation {
+	if adaptation.MinRate.IsZero() {
+		adaptation.MinRate = Per(1, adaptation.MaxRate.Period)
+	}
+
+	if adaptation.Increase <= 0 {
+		adaptation.Increase = 1
+	}
+
+	if adaptation.DecreaseFactor <= 0 || adaptation.DecreaseFactor >= 1 {
+		adaptation.DecreaseFactor = 0.5
+	}
+
+	if adaptation.Cooldown <= 0 {
+		adaptation.Cooldown = time.Second
+	}
+
+	return adaptation
+}
+
+// AdaptiveLimiter represents a token bucket rate limiter whose rate adapts to the outcomes of events reported by callers, using additive increase and multiplicative decrease (AIMD).
+// The rate grows by a fixed step on each success, and is cut by a factor on each overload, always staying between a floor and a ceiling.
+// The rate is adapted by each instance from the outcomes it observes, while buckets are stored in the cache as with any RateLimiter.
+type AdaptiveLimiter struct {
+	*RateLimiter
+
+	adaptation   Adaptation // How the rate adapts to the outcomes of events.
+	events       float64    // The current rate, in events per period of the maximum rate.
+	minEvents    float64    // The floor of the rate, in events per period of the maximum rate.
+	maxEvents    float64    // The ceiling of the rate, in events per period of the maximum rate.
+	applied      Rate       // The rate applied to the limiter.
+	lastDecrease time.Time  // The time of the last decrease, to apply the cooldown.
+
+	mu sync.Mutex
+}
+
+// Report adapts the rate to the outcome of an event: success increases it additively and overload decreases it multiplicatively.
+func (al *AdaptiveLimiter) Report(outcome Outcome) {
+	if al.adaptation.MaxRate.IsZero() {
+		return
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	switch outcome {
+	case Overload:
+		now := al.clock.Now()
+		if !al.lastDecrease.IsZero() && now.Sub(al.lastDecrease) < al.adaptation.Cooldown {
+			return
+		}
+		al.lastDecrease = now
+
+		al.events = math.Max(al.events*al.adaptation.DecreaseFactor, al.minEvents)
+	default:
+		al.events = math.Min(al.events+float64(al.adaptation.Increase), al.maxEvents)
+	}
+
+	al.apply()
+}
+
+// ReportLatency adapts the rate to the latency of an event, which counts as overload above the latency threshold and as success otherwise.
+func (al *AdaptiveLimiter) ReportLatency(latency time.Duration) {
+	if al.adaptation.LatencyThreshold > 0 && latency > al.adaptation.LatencyThreshold {
+		al.Report(Overload)
+		return
+	}
+
+	al.Report(Success)
+}
+
+// Rate returns the current rate of the limiter.
+func (al *AdaptiveLimiter) Rate() Rate {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	return al.applied
+}
+
+// apply changes the rate of the limiter to the current rate, rounded to whole events per period of the maximum rate.
+// It must be called with the lock held.
+func (al *AdaptiveLimiter) apply() {
+	rate := Per(int(math.Round(al.events)), al.adaptation.MaxRate.Period)
+	if al.events <= al.minEvents || rate.Events < 1 {
+		// the floor can be a slower rate than one event per period of the maximum rate
+		rate = al.adaptation.MinRate
+	}
+
+	if rate != al.applied {
+		al.applied = rate
+		al.SetLimit(rate)
+	}
+}
+
+// eventsPer returns the number of events a rate allows in the given period.
+func eventsPer(rate Rate, period time.Duration) float64 {
+	if rate.Period <= 0 {
+		return 0
+	}
+
+	return float64(rate.Events) * float64(period) / float64(rate.Period)
+}
+
+// NewAdaptive creates a new ready to use AdaptiveLimiter with the specified options, adapting its rate as specified by adaptation.
+// The rate of the options is the initial rate, which defaults to the maximum rate of the adaptation. Bandwidths are not adapted.
+func NewAdaptive(options Options, adaptation Adaptation) *AdaptiveLimiter {
+	if options.Rate.IsZero() && options.MaxRatePerSecond == 0 {
+		options.Rate = adaptation.MaxRate
+	}
+
+	al := &AdaptiveLimiter{
+		RateLimiter: New(options),
+		adaptation:  adaptation,
+	}
+
+	if adaptation.MaxRate.IsZero() {
+		al.applied = al.RateLimiter.rate
+		return al
+	}
+
+	al.adaptation = normalizeAdaptation(adaptation)
+
+	period := al.adaptation.MaxRate.Period
+	al.minEvents = eventsPer(al.adaptation.MinRate, period)
+	al.maxEvents = float64(al.adaptation.MaxRate.Events)
+	al.events = math.Min(math.Max(eventsPer(al.RateLimiter.rate, period), al.minEvents), al.maxEvents)
+	al.applied = al.RateLimiter.rate
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.apply()
+
+	return al
+}
@@ -0,0 +1,106 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestAdaptiveLimiter_Increases_Additively_And_Decreases_Multiplicatively(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.NewAdaptive(ratelimiter.Options{
+		Rate:     ratelimiter.Per(10, time.Second),
+		MaxBurst: 10,
+		Clock:    clock,
+	}, ratelimiter.Adaptation{
+		MinRate:  ratelimiter.Per(2, time.Second),
+		MaxRate:  ratelimiter.Per(12, time.Second),
+		Increase: 1,
+	})
+
+	steps := []struct {
+		outcome  ratelimiter.Outcome
+		advance  time.Duration
+		expected int
+	}{
+		{outcome: ratelimiter.Success, expected: 11},
+		{outcome: ratelimiter.Success, expected: 12},
+		{outcome: ratelimiter.Success, expected: 12},
+		{outcome: ratelimiter.Overload, expected: 6},
+		// overload signals from the same incident only decrease the rate once
+		{outcome: ratelimiter.Overload, advance: 500 * time.Millisecond, expected: 6},
+		{outcome: ratelimiter.Overload, advance: 500 * time.Millisecond, expected: 3},
+		{outcome: ratelimiter.Overload, advance: time.Second, expected: 2},
+		{outcome: ratelimiter.Success, expected: 3},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		limiter.Report(step.outcome)
+
+		if rate := limiter.Rate(); rate != ratelimiter.Per(step.expected, time.Second) {
+			t.Fatalf("Expected rate %d/s after step %d, but got %d/%v", step.expected, i, rate.Events, rate.Period)
+		}
+	}
+
+	if result := ratelimitertest.AssertAllowed(t, limiter, "test"); result.Limit != 3 {
+		t.Errorf("Expected the adapted limit to be 3, but got %d", result.Limit)
+	}
+}
+
+func TestAdaptiveLimiter_Floor_Can_Be_Slower_Than_One_Event_Per_Period(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.NewAdaptive(ratelimiter.Options{
+		MaxBurst: 10,
+		Clock:    clock,
+	}, ratelimiter.Adaptation{
+		MinRate: ratelimiter.Per(30, time.Minute),
+		MaxRate: ratelimiter.Per(4, time.Second),
+	})
+
+	if rate := limiter.Rate(); rate != ratelimiter.Per(4, time.Second) {
+		t.Fatalf("Expected the initial rate to be the maximum one, but got %d/%v", rate.Events, rate.Period)
+	}
+
+	for _, expected := range []int{2, 1} {
+		limiter.Report(ratelimiter.Overload)
+		if rate := limiter.Rate(); rate != ratelimiter.Per(expected, time.Second) {
+			t.Fatalf("Expected rate %d/s, but got %d/%v", expected, rate.Events, rate.Period)
+		}
+
+		clock.Advance(time.Second)
+	}
+
+	limiter.Report(ratelimiter.Overload)
+	if rate := limiter.Rate(); rate != ratelimiter.Per(30, time.Minute) {
+		t.Errorf("Expected the rate to reach the floor, but got %d/%v", rate.Events, rate.Period)
+	}
+}
+
+func TestAdaptiveLimiter_ReportLatency_Counts_Slow_Events_As_Overload(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.NewAdaptive(ratelimiter.Options{
+		Rate:     ratelimiter.Per(5, time.Second),
+		MaxBurst: 10,
+		Clock:    clock,
+	}, ratelimiter.Adaptation{
+		MaxRate:          ratelimiter.Per(10, time.Second),
+		Increase:         2,
+		LatencyThreshold: 100 * time.Millisecond,
+	})
+
+	limiter.ReportLatency(100 * time.Millisecond)
+	if rate := limiter.Rate(); rate.Events != 7 {
+		t.Fatalf("Expected rate 7/s after a fast event, but got %d/%v", rate.Events, rate.Period)
+	}
+
+	limiter.ReportLatency(101 * time.Millisecond)
+	if rate := limiter.Rate(); rate.Events != 4 {
+		t.Errorf("Expected rate 4/s after a slow event, but got %d/%v", rate.Events, rate.Period)
+	}
+}
@@ -0,0 +1,216 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// State represents the state stored for a particular key, as reported by Inspect.
+type State struct {
+	Remaining   int           // The number of tokens available now.
+	Bucket      int           // The number of tokens stored in the bucket, before refilling it. Only set for the TokenBucket algorithm.
+	LastFill    time.Time     // The time up to which elapsed time was turned into tokens. Only set for the TokenBucket algorithm, and zero if no bucket is stored.
+	TTL         time.Duration // The time left before the stored state expires. Zero if no state is stored or if the cache does not implement [cache.TTLReader].
+	Bands       []State       // The state of each bandwidth, when several limits are applied together.
+	BannedUntil time.Time     // The time when the ban of the key ends. Zero if it is not banned, or if the limiter has no Penalty.
+}
+
+// Reset removes the state stored for a particular key, so its bucket is full again, eg. to unblock a customer.
+// Bans and violations counted by the penalty of the limiter are removed as well.
+// It returns an error if cache operations fail, or ErrUnsupportedCache if the cache does not implement [cache.Deleter].
+func (rl *RateLimiter) Reset(sourceKey string) error {
+	return rl.ResetCtx(context.Background(), sourceKey)
+}
+
+// ResetCtx works like Reset, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) ResetCtx(ctx context.Context, sourceKey string) error {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).ResetCtx(ctx, sourceKey)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	deleter, ok := rl.cacheFor(ctx).(cache.Deleter)
+	if !ok {
+		return ErrUnsupportedCache
+	}
+
+	keys := rl.stateKeysFor(sourceKey)
+	if rl.penalty.BanDuration > 0 {
+		keys = append(keys, rl.penaltyKeysFor(sourceKey)...)
+	}
+
+	if err := deleter.Delete(keys...); err != nil {
+		return cacheError(err)
+	}
+
+	return nil
+}
+
+// Set stores the state for a particular key so it has the given number of tokens available, clamped between zero and the maximum burst.
+// Limiters configured with Bandwidths set the tokens of every band, up to the maximum burst of each one.
+// It returns an error if cache operations fail, or ErrUnsupportedCache if the SlidingWindowLog algorithm is used and the cache does not implement [cache.Deleter].
+func (rl *RateLimiter) Set(sourceKey string, tokens int) error {
+	return rl.SetCtx(context.Background(), sourceKey, tokens)
+}
+
+// SetCtx works like Set, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) SetCtx(ctx context.Context, sourceKey string, tokens int) error {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).SetCtx(ctx, sourceKey, tokens)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	if tokens < 0 {
+		tokens = 0
+	}
+
+	if tokens > rl.maxBurst && len(rl.bands) == 0 {
+		tokens = rl.maxBurst
+	}
+
+	var err error
+	switch {
+	case len(rl.bands) > 0:
+		err = rl.setBandTokens(ctx, sourceKey, tokens)
+	case rl.algorithm == SlidingWindowLog:
+		err = rl.setLogTokens(ctx, sourceKey, tokens)
+	case rl.algorithm == SlidingWindowCounter:
+		err = rl.setWindowCounterTokens(ctx, sourceKey, tokens)
+	case rl.algorithm == FixedWindow:
+		err = rl.setFixedWindowTokens(ctx, sourceKey, tokens)
+	case rl.algorithm == GCRA:
+		err = rl.setArrivalTokens(ctx, sourceKey, tokens)
+	default:
+		err = rl.setBucketTokens(ctx, sourceKey, tokens)
+	}
+
+	if err != nil {
+		return cacheError(err)
+	}
+
+	return nil
+}
+
+// Inspect returns the state stored for a particular key without changing it, eg. to check why a customer was rate limited.
+// Unlike Remaining, failed cache operations are returned instead of following the failure policy.
+func (rl *RateLimiter) Inspect(sourceKey string) (State, error) {
+	return rl.InspectCtx(context.Background(), sourceKey)
+}
+
+// InspectCtx works like Inspect, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) InspectCtx(ctx context.Context, sourceKey string) (State, error) {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).InspectCtx(ctx, sourceKey)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	state, err := rl.inspect(ctx, sourceKey)
+	if err != nil {
+		return State{}, cacheError(err)
+	}
+
+	if rl.penalty.BanDuration > 0 {
+		bannedUntil, err := rl.bannedUntil(ctx, sourceKey)
+		if err != nil {
+			return State{}, cacheError(err)
+		}
+
+		if bannedUntil > 0 {
+			state.BannedUntil = time.UnixMilli(int64(bannedUntil))
+		}
+	}
+
+	return state, nil
+}
+
+// inspect returns the state stored for a particular key, using the configured algorithm.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) inspect(ctx context.Context, sourceKey string) (State, error) {
+	if len(rl.bands) > 0 {
+		var state State
+
+		for i, band := range rl.bands {
+			bandState, err := band.inspect(ctx, rl.getBandKeyFor(sourceKey, i))
+			if err != nil {
+				return State{}, err
+			}
+
+			if i == 0 || bandState.Remaining < state.Remaining {
+				state.Remaining = bandState.Remaining
+			}
+
+			if bandState.TTL > state.TTL {
+				state.TTL = bandState.TTL
+			}
+
+			state.Bands = append(state.Bands, bandState)
+		}
+
+		return state, nil
+	}
+
+	remaining, err := rl.remainingFor(ctx, sourceKey)
+	if err != nil {
+		return State{}, err
+	}
+
+	state := State{Remaining: remaining}
+
+	if rl.algorithm == TokenBucket {
+		stored, err := rl.getStateFor(ctx, sourceKey)
+		if err != nil {
+			return State{}, err
+		}
+
+		state.Bucket = stored.tokens
+		if stored.lastFill > 0 {
+			state.LastFill = time.UnixMilli(int64(stored.lastFill))
+		}
+	}
+
+	keys := rl.stateKeysFor(sourceKey)
+	if reader, ok := rl.cacheFor(ctx).(cache.TTLReader); ok && len(keys) > 0 {
+		ttl, err := reader.TTL(keys[0])
+		if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+			return State{}, err
+		}
+		state.TTL = ttl
+	}
+
+	return state, nil
+}
+
+// stateKeysFor returns the cache keys holding the state of a particular key for the configured algorithm, starting with the one that expires last.
+func (rl *RateLimiter) stateKeysFor(sourceKey string) []string {
+	switch {
+	case len(rl.bands) > 0:
+		var keys []string
+		for i, band := range rl.bands {
+			keys = append(keys, band.stateKeysFor(rl.getBandKeyFor(sourceKey, i))...)
+		}
+		return keys
+	case rl.algorithm == SlidingWindowLog:
+		return []string{rl.getLogKeyFor(sourceKey)}
+	case rl.algorithm == SlidingWindowCounter || rl.algorithm == FixedWindow:
+		if rl.maxRatePerMillisecond <= 0 {
+			// an infinite window never counts events
+			return nil
+		}
+
+		window := int(rl.clock.Now().UnixMilli()) / rl.countWindowMilliseconds()
+		return []string{rl.getWindowKeyFor(sourceKey, window), rl.getWindowKeyFor(sourceKey, window-1)}
+	case rl.algorithm == GCRA:
+		return []string{rl.getArrivalKeyFor(sourceKey)}
+	default:
+		return []string{rl.getBucketKeyFor(sourceKey), rl.getLastFillKeyFor(sourceKey)}
+	}
+}
@@ -0,0 +1,190 @@
+package ratelimiter_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_Reset_Fills_The_Bucket(t *testing.T) {
+	algorithms := map[string]ratelimiter.Algorithm{
+		"token bucket":           ratelimiter.TokenBucket,
+		"sliding window log":     ratelimiter.SlidingWindowLog,
+		"sliding window counter": ratelimiter.SlidingWindowCounter,
+		"fixed window":           ratelimiter.FixedWindow,
+		"gcra":                   ratelimiter.GCRA,
+	}
+
+	for name, algorithm := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			clock := ratelimitertest.NewClock(time.Time{})
+
+			limiter := ratelimiter.New(ratelimiter.Options{
+				Rate:      ratelimiter.Per(1, time.Minute),
+				MaxBurst:  3,
+				Algorithm: algorithm,
+				Clock:     clock,
+			})
+
+			ratelimitertest.AssertAllowedN(t, limiter, "test", 3)
+			ratelimitertest.AssertDenied(t, limiter, "test")
+
+			if err := limiter.Reset("test"); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if remaining := limiter.Remaining("test"); remaining != 3 {
+				t.Errorf("Expected 3 remaining events after reset, but got %d", remaining)
+			}
+
+			ratelimitertest.AssertAllowedN(t, limiter, "test", 3)
+		})
+	}
+}
+
+func TestRateLimiter_Reset_Requires_A_Deleter(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         3,
+		Cache:            &mockFailedWritesCache{},
+	})
+
+	if err := limiter.Reset("test"); !errors.Is(err, ratelimiter.ErrUnsupportedCache) {
+		t.Errorf("Expected error %v, but got %v", ratelimiter.ErrUnsupportedCache, err)
+	}
+}
+
+func TestRateLimiter_Set_Stores_The_Given_Tokens(t *testing.T) {
+	algorithms := map[string]ratelimiter.Algorithm{
+		"token bucket":           ratelimiter.TokenBucket,
+		"sliding window log":     ratelimiter.SlidingWindowLog,
+		"sliding window counter": ratelimiter.SlidingWindowCounter,
+		"fixed window":           ratelimiter.FixedWindow,
+		"gcra":                   ratelimiter.GCRA,
+	}
+
+	tests := []struct {
+		name              string
+		tokens            int
+		expectedRemaining int
+	}{
+		{name: "empty", tokens: 0, expectedRemaining: 0},
+		{name: "partial", tokens: 2, expectedRemaining: 2},
+		{name: "full", tokens: 5, expectedRemaining: 5},
+		{name: "above burst", tokens: 10, expectedRemaining: 5},
+		{name: "negative", tokens: -1, expectedRemaining: 0},
+	}
+
+	for name, algorithm := range algorithms {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				limiter := ratelimiter.New(ratelimiter.Options{
+					Rate:      ratelimiter.Per(1, time.Minute),
+					MaxBurst:  5,
+					Algorithm: algorithm,
+					Clock:     ratelimitertest.NewClock(time.Time{}),
+				})
+
+				// state stored before is replaced
+				ratelimitertest.AssertAllowed(t, limiter, "test")
+
+				if err := limiter.Set("test", tt.tokens); err != nil {
+					t.Fatalf("Expected no error, but got %v", err)
+				}
+
+				if remaining := limiter.Remaining("test"); remaining != tt.expectedRemaining {
+					t.Errorf("Expected %d remaining events, but got %d", tt.expectedRemaining, remaining)
+				}
+
+				if tt.expectedRemaining > 0 {
+					ratelimitertest.AssertAllowedN(t, limiter, "test", tt.expectedRemaining)
+				}
+				ratelimitertest.AssertDenied(t, limiter, "test")
+			})
+		}
+	}
+}
+
+func TestRateLimiter_Inspect_Reports_The_Stored_Bucket(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         5,
+		Cache:            cache.NewInMemory(clock),
+		Clock:            clock,
+	})
+
+	state, err := limiter.Inspect("test")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if state.Remaining != 5 || state.Bucket != 0 || !state.LastFill.IsZero() || state.TTL != 0 {
+		t.Errorf("Expected a full bucket with nothing stored, but got %+v", state)
+	}
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 3)
+	lastFill := clock.Now()
+
+	clock.Advance(1500 * time.Millisecond)
+
+	state, err = limiter.Inspect("test")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	expected := ratelimiter.State{
+		Remaining: 3,
+		Bucket:    2,
+		LastFill:  lastFill,
+		TTL:       10*time.Second - 1500*time.Millisecond,
+	}
+
+	if !state.LastFill.Equal(expected.LastFill) {
+		t.Errorf("Expected last fill to be %v, but got %v", expected.LastFill, state.LastFill)
+	}
+
+	state.LastFill = expected.LastFill
+	if state.Remaining != expected.Remaining || state.Bucket != expected.Bucket || state.TTL != expected.TTL {
+		t.Errorf("Expected state to be %+v, but got %+v", expected, state)
+	}
+
+	// inspecting does not refill the stored bucket
+	if again, _ := limiter.Inspect("test"); again.Bucket != 2 || !again.LastFill.Equal(lastFill) {
+		t.Errorf("Expected the stored bucket to be unchanged, but got %+v", again)
+	}
+}
+
+func TestRateLimiter_Inspect_Reports_Every_Band(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(10, time.Second), MaxBurst: 10},
+			{Rate: ratelimiter.Per(100, time.Hour), MaxBurst: 100},
+		},
+		Clock: ratelimitertest.NewClock(time.Time{}),
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 4)
+
+	state, err := limiter.Inspect("test")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if len(state.Bands) != 2 || state.Bands[0].Bucket != 6 || state.Bands[1].Bucket != 96 {
+		t.Fatalf("Expected the buckets of both bands, but got %+v", state.Bands)
+	}
+
+	if state.Remaining != 6 {
+		t.Errorf("Expected 6 remaining events, but got %d", state.Remaining)
+	}
+
+	if state.TTL != time.Hour {
+		t.Errorf("Expected TTL to be the one of the longest band, but got %v", state.TTL)
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimiter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// Bandwidth represents one of several limits applied together to the same key, such as a short-term burst limit and an hourly quota.
+type Bandwidth struct {
+	Rate     Rate // The maximum rate of events allowed in this band.
+	MaxBurst int  // The maximum number of events that can be bursted in this band.
+}
+
+// getBandKeyFor returns the source key under which the state of a band is stored.
+func (rl *RateLimiter) getBandKeyFor(sourceKey string, band int) string {
+	return sourceKey + ":band:" + strconv.Itoa(band)
+}
+
+// newBands creates a token bucket limiter for each bandwidth, sharing the cache of the parent limiter.
+func newBands(bandwidths []Bandwidth, options Options) []*RateLimiter {
+	bands := make([]*RateLimiter, len(bandwidths))
+
+	for i, bandwidth := range bandwidths {
+		bands[i] = New(Options{
+			Rate:       bandwidth.Rate,
+			MaxBurst:   bandwidth.MaxBurst,
+			Cache:      options.Cache,
+			CacheTTL:   options.CacheTTL,
+			Clock:      options.Clock,
+			Namespace:  options.Namespace,
+			KeyBuilder: options.KeyBuilder,
+		})
+	}
+
+	return bands
+}
+
+// bandKeysFor returns the source keys under which the states of all bands are stored.
+func (rl *RateLimiter) bandKeysFor(sourceKey string) []string {
+	keys := make([]string, len(rl.bands))
+	for i := range rl.bands {
+		keys[i] = rl.getBandKeyFor(sourceKey, i)
+	}
+
+	return keys
+}
+
+// takeFromBands consumes n tokens from the bucket of every band for a particular key if they are all available, or from none of them.
+// If the cache implements [cache.CompareAndSwapper], the buckets of all bands are updated atomically.
+// The result is the one of the binding band, which is the one delaying events for the longest time, or the one with fewer remaining events if none delays them.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) takeFromBands(ctx context.Context, sourceKey string, n int) (Result, error) {
+	result, band, err := takeFromBuckets(ctx, rl.bands, rl.bandKeysFor(sourceKey), n)
+	result.Band = band
+
+	return result, err
+}
+
+// takeFromBuckets consumes n tokens for each key from the bucket of the token bucket limiter at the same index if they are all available, or from none of them.
+// If the cache implements [cache.CompareAndSwapper], all buckets are updated atomically.
+// The result is the one of the binding bucket, which is the one delaying events for the longest time, or the one with fewer remaining events if none delays them, and it is returned along with its index.
+// It returns an error if cache operations fail.
+func takeFromBuckets(ctx context.Context, limiters []*RateLimiter, keys []string, n int) (Result, int, error) {
+	for {
+		now := int(limiters[0].clock.Now().UnixMilli())
+
+		stored := make([]bucketState, len(limiters))
+		states := make([]bucketState, len(limiters))
+		allowed := true
+
+		for i, limiter := range limiters {
+			state, err := limiter.getStateFor(ctx, keys[i])
+			if err != nil {
+				return Result{}, 0, err
+			}
+
+			stored[i] = state
+			states[i] = limiter.fillBucket(state, now)
+			if states[i].tokens < n {
+				allowed = false
+			}
+		}
+
+		if allowed {
+			for i := range states {
+				states[i].tokens -= n
+			}
+
+			swapped, err := setBucketStatesFor(ctx, limiters, keys, stored, states)
+			if err != nil {
+				return Result{}, 0, err
+			}
+
+			if !swapped {
+				// a bucket was changed by a concurrent caller, try again with the updated states
+				continue
+			}
+		}
+
+		var result Result
+		var binding int
+		for i, limiter := range limiters {
+			bucketResult := limiter.resultFor(states[i], n, now, allowed)
+
+			if i == 0 || bucketResult.RetryAfter > result.RetryAfter ||
+				(bucketResult.RetryAfter == result.RetryAfter && bucketResult.Remaining < result.Remaining) {
+				result, binding = bucketResult, i
+			}
+		}
+
+		return result, binding, nil
+	}
+}
+
+// setBucketStatesFor stores the updated bucket state of each key, using the token bucket limiter at the same index.
+// If the cache supports compare-and-swap, the states are only stored if they all still match the previously stored states, and the result reports whether they were stored.
+// It returns an error if cache operations fail.
+func setBucketStatesFor(ctx context.Context, limiters []*RateLimiter, keys []string, stored, updated []bucketState) (bool, error) {
+	if cas, ok := limiters[0].cacheFor(ctx).(cache.CompareAndSwapper); ok {
+		cacheKeys := make([]string, 0, 2*len(limiters))
+		oldValues := make([]int, 0, 2*len(limiters))
+		newValues := make([]int, 0, 2*len(limiters))
+		var expiration time.Duration
+		now := int(limiters[0].clock.Now().UnixMilli())
+
+		for i, limiter := range limiters {
+			cacheKeys = append(cacheKeys, limiter.getBucketKeyFor(keys[i]), limiter.getLastFillKeyFor(keys[i]))
+			oldValues = append(oldValues, stored[i].tokens, stored[i].lastFill)
+			newValues = append(newValues, updated[i].tokens, updated[i].lastFill)
+
+			if bucketExpiration := limiter.bucketExpiration(updated[i], now); bucketExpiration > expiration {
+				expiration = bucketExpiration
+			}
+		}
+
+		return cas.CompareAndSwap(cacheKeys, oldValues, newValues, expiration)
+	}
+
+	for i, limiter := range limiters {
+		if _, err := limiter.setStateFor(ctx, keys[i], stored[i], updated[i]); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// remainingInBands returns the number of tokens available in all bands for a particular key without consuming them.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingInBands(ctx context.Context, sourceKey string) (int, error) {
+	remaining := -1
+
+	for i, band := range rl.bands {
+		tokens, err := band.remainingInBucket(ctx, rl.getBandKeyFor(sourceKey, i))
+		if err != nil {
+			return 0, err
+		}
+
+		if remaining < 0 || tokens < remaining {
+			remaining = tokens
+		}
+	}
+
+	return remaining, nil
+}
+
+// minBurst returns the smallest maximum burst of the bandwidths, which is the most events that can be allowed at once.
+func minBurst(bandwidths []Bandwidth) int {
+	burst := bandwidths[0].MaxBurst
+
+	for _, bandwidth := range bandwidths[1:] {
+		if bandwidth.MaxBurst < burst {
+			burst = bandwidth.MaxBurst
+		}
+	}
+
+	return burst
+}
+
+// setBandTokens stores buckets holding the given tokens for a particular key in every band, up to the maximum burst of each band.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setBandTokens(ctx context.Context, sourceKey string, tokens int) error {
+	for i, band := range rl.bands {
+		bandTokens := tokens
+		if bandTokens > band.maxBurst {
+			bandTokens = band.maxBurst
+		}
+
+		if err := band.setBucketTokens(ctx, rl.getBandKeyFor(sourceKey, i), bandTokens); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
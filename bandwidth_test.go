@@ -0,0 +1,131 @@
+package ratelimiter_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_Bandwidths_Allow(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// 5 events per 100 milliseconds, but only 8 per minute
+	options := ratelimiter.Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(5, 100*time.Millisecond), MaxBurst: 5},
+			{Rate: ratelimiter.Per(8, time.Minute), MaxBurst: 8},
+		},
+		Clock: clock,
+	}
+	limiter := ratelimiter.New(options)
+
+	// Allow 5 events, bound by the short-term band
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	result, _ := limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.Band != 0 || result.Limit != 5 {
+		t.Errorf("Expected the short-term band to bind the decision, but got band %d with limit %d", result.Band, result.Limit)
+	}
+
+	// Allow 3 more events once the short-term band refills, then the quota is exhausted
+	clock.Advance(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	result, _ = limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.Band != 1 || result.Limit != 8 {
+		t.Errorf("Expected the quota band to bind the decision, but got band %d with limit %d", result.Band, result.Limit)
+	}
+
+	if result.RetryAfter < time.Second {
+		t.Errorf("Expected retry after to wait for the quota band, but got %v", result.RetryAfter)
+	}
+}
+
+func TestRateLimiter_Bandwidths_Consume_All_Or_None(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(10, time.Minute), MaxBurst: 10},
+			{Rate: ratelimiter.Per(3, time.Minute), MaxBurst: 3},
+		},
+	}
+	limiter := ratelimiter.New(options)
+
+	// Exhaust the second band
+	if allowed, _ := limiter.AllowN(sourceKey, 3); !allowed {
+		t.Errorf("Expected limiter to allow events, but it didn't")
+	}
+
+	// Denied events must not consume from the first band
+	for i := 0; i < 5; i++ {
+		if limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to rate-limit event, but it didn't")
+		}
+	}
+
+	result, _ := limiter.Decide(sourceKey)
+	if result.Band != 1 {
+		t.Errorf("Expected the second band to bind the decision, but got band %d", result.Band)
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected 0 remaining events, but got %d", remaining)
+	}
+
+	// Events costing more than the smallest burst can never be allowed
+	if _, err := limiter.AllowN("other", 4); err != ratelimiter.ErrExceedsBurst {
+		t.Errorf("Expected error %v, but got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+}
+
+func TestRateLimiter_Bandwidths_Do_Not_Overspend_Under_Concurrency(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(50, time.Minute), MaxBurst: 50},
+			{Rate: ratelimiter.Per(20, time.Minute), MaxBurst: 20},
+		},
+	}
+	limiter := ratelimiter.New(options)
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Allow(sourceKey) {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 20 {
+		t.Errorf("Expected limiter to allow 20 events, but it allowed %d", allowed)
+	}
+}
@@ -2,6 +2,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -16,3 +17,63 @@ type GetterSetter interface {
 	Set(key string, value int) error
 	SetWithExpiration(key string, value int, expiration time.Duration) error
 }
+
+// ContextGetterSetter represents an optional cache capability for honouring the cancellation and deadline of a context, eg. the one of an HTTP request.
+// Operations given up on because the context is done return the context error.
+type ContextGetterSetter interface {
+	GetContext(ctx context.Context, key string) (int, error)
+	SetContext(ctx context.Context, key string, value int) error
+	SetWithExpirationContext(ctx context.Context, key string, value int, expiration time.Duration) error
+	// WithContext returns a copy of the cache whose operations, including the optional capabilities it implements, use ctx.
+	WithContext(ctx context.Context) GetterSetter
+}
+
+// CompareAndSwapper represents an optional cache capability for atomically updating several keys at once.
+// Missing or expired keys are compared as zero, matching the value returned by Get on a cache miss.
+type CompareAndSwapper interface {
+	// CompareAndSwap stores newValues for keys with the given expiration, only if all keys currently hold oldValues.
+	// It reports whether the values were swapped.
+	CompareAndSwap(keys []string, oldValues, newValues []int, expiration time.Duration) (bool, error)
+}
+
+// EventLogger represents an optional cache capability for keeping logs of event timestamps, used by sliding window algorithms.
+// Timestamps are Unix times in milliseconds.
+type EventLogger interface {
+	// LogEvents atomically drops the timestamps older than since from the log stored at key and, if the log would not exceed limit entries, appends n timestamps at now.
+	// The log expires after the given expiration. If expiration is 0, the log never expires.
+	// It returns whether the timestamps were appended and the timestamps left in the log, oldest first.
+	LogEvents(key string, since, now, n, limit int, expiration time.Duration) (bool, []int, error)
+	// EventLog returns the timestamps in the log stored at key that are not older than since, oldest first, without changing the log.
+	EventLog(key string, since int) ([]int, error)
+	// RemoveEvent removes a single timestamp equal to timestamp from the log stored at key, if there is any.
+	RemoveEvent(key string, timestamp int) error
+}
+
+// Incrementer represents an optional cache capability for atomically incrementing counters.
+type Incrementer interface {
+	// IncrementWithExpiration atomically adds delta to the value stored at key and returns the new value.
+	// Missing or expired keys are incremented from zero and set to expire after the given expiration, which is kept on further increments.
+	// If expiration is 0, the value never expires.
+	IncrementWithExpiration(key string, delta int, expiration time.Duration) (int, error)
+}
+
+// Advancer represents an optional cache capability for atomically advancing values up to a ceiling, used by algorithms storing a single timestamp per key.
+type Advancer interface {
+	// AdvanceWithExpiration atomically raises the value stored at key to at least floor and adds delta to it, storing the result with the given expiration only if it does not exceed ceiling.
+	// Missing or expired keys are treated as zero. If expiration is 0, the value never expires.
+	// It returns the resulting value, or the raised value if it was not stored, and whether it was stored.
+	AdvanceWithExpiration(key string, floor, delta, ceiling int, expiration time.Duration) (int, bool, error)
+}
+
+// Deleter represents an optional cache capability for removing keys, used by administrative operations such as resetting the state of a key.
+type Deleter interface {
+	// Delete removes the values and event logs stored at keys. Missing keys are ignored.
+	Delete(keys ...string) error
+}
+
+// TTLReader represents an optional cache capability for reading the time left before keys expire, used to inspect the state of a key.
+type TTLReader interface {
+	// TTL returns the time left before the value or event log stored at key expires, or 0 if it never expires.
+	// error is ErrCacheMiss if key is not present in the cache.
+	TTL(key string) (time.Duration, error)
+}
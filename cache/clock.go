@@ -0,0 +1,25 @@
+package cache
+
+import "time"
+
+// Clock represents a source of the current time, so time can be controlled in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// monotonicClock represents a clock that advances with the monotonic clock of the system, starting from the wall clock time when it was created.
+type monotonicClock struct {
+	start time.Time // The time when the clock was created, carrying a monotonic clock reading.
+}
+
+// NewMonotonicClock creates a Clock that advances with the monotonic clock of the system, so wall clock jumps, eg. from NTP corrections, do not move it.
+// It starts from the current wall clock time, so times read from clocks created in different processes stay comparable.
+func NewMonotonicClock() Clock {
+	return monotonicClock{start: time.Now()}
+}
+
+// Now returns the current time.
+func (c monotonicClock) Now() time.Time {
+	// adding the elapsed monotonic time to the start keeps the wall clock reading of the result from jumping
+	return c.start.Add(time.Since(c.start))
+}
@@ -11,17 +11,90 @@ type inMemoryEntry struct {
 	expiration int // Unix time in milliseconds when the entry expires
 }
 
+// inMemoryLog represents an event log stored as a ring buffer of timestamps, that supports expiration.
+type inMemoryLog struct {
+	timestamps []int // Ring buffer of Unix times in milliseconds, grown on demand up to the log limit
+	head       int   // Index of the oldest timestamp in the ring buffer
+	size       int   // Number of timestamps in the ring buffer
+	expiration int   // Unix time in milliseconds when the log expires
+}
+
+// at returns the i-th oldest timestamp in the log.
+func (l *inMemoryLog) at(i int) int {
+	return l.timestamps[(l.head+i)%len(l.timestamps)]
+}
+
+// dropOlderThan removes the timestamps older than since from the log.
+func (l *inMemoryLog) dropOlderThan(since int) {
+	for l.size > 0 && l.at(0) < since {
+		l.head = (l.head + 1) % len(l.timestamps)
+		l.size--
+	}
+}
+
+// resize changes the capacity of the ring buffer, keeping the newest timestamps that fit.
+func (l *inMemoryLog) resize(capacity int) {
+	timestamps := make([]int, capacity)
+	skip := 0
+	if l.size > capacity {
+		skip = l.size - capacity
+	}
+
+	for i := skip; i < l.size; i++ {
+		timestamps[i-skip] = l.at(i)
+	}
+
+	l.timestamps = timestamps
+	l.head = 0
+	l.size -= skip
+}
+
+// remove removes a single timestamp equal to timestamp from the log, shifting the newer ones back.
+func (l *inMemoryLog) remove(timestamp int) {
+	for i := 0; i < l.size; i++ {
+		if l.at(i) != timestamp {
+			continue
+		}
+
+		for j := i; j < l.size-1; j++ {
+			l.timestamps[(l.head+j)%len(l.timestamps)] = l.at(j + 1)
+		}
+		l.size--
+		return
+	}
+}
+
+// list returns a copy of the timestamps in the log, oldest first.
+func (l *inMemoryLog) list() []int {
+	timestamps := make([]int, l.size)
+	for i := range timestamps {
+		timestamps[i] = l.at(i)
+	}
+	return timestamps
+}
+
 // InMemory represents an in-memory cache that stores values in memory.
 type InMemory struct {
 	cache map[string]inMemoryEntry
+	logs  map[string]*inMemoryLog
+	clock Clock
 	mu    sync.Mutex
 }
 
 // NewInMemory creates a new ready to use InMemory cache.
-func NewInMemory() *InMemory {
-	return &InMemory{
+// Entries expire according to the given clock, or to a monotonic clock if none is given.
+func NewInMemory(clock ...Clock) *InMemory {
+	c := &InMemory{
 		cache: make(map[string]inMemoryEntry),
+		logs:  make(map[string]*inMemoryLog),
+		clock: NewMonotonicClock(),
 	}
+
+	if len(clock) > 0 && clock[0] != nil {
+		c.clock = clock[0]
+	}
+
+	return c
 }
 
 // Get retrieves a value from the cache.
@@ -31,7 +104,7 @@ func (c *InMemory) Get(key string) (int, error) {
 	defer c.mu.Unlock()
 
 	if entry, ok := c.cache[key]; ok {
-		if entry.expiration > 0 && entry.expiration <= int(time.Now().UnixMilli()) {
+		if entry.expiration > 0 && entry.expiration <= int(c.clock.Now().UnixMilli()) {
 			delete(c.cache, key)
 			return 0, ErrCacheMiss
 		}
@@ -51,11 +124,233 @@ func (c *InMemory) Set(key string, value int) error {
 func (c *InMemory) SetWithExpiration(key string, value int, expiration time.Duration) error {
 	var expirationTime int
 	if expiration > 0 {
-		expirationTime = int(time.Now().Add(expiration).UnixMilli())
+		expirationTime = int(c.clock.Now().Add(expiration).UnixMilli())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache[key] = inMemoryEntry{value: value, expiration: expirationTime}
+	return nil
+}
+
+// CompareAndSwap stores newValues for keys with the given expiration, only if all keys currently hold oldValues.
+// Missing or expired keys are compared as zero. If expiration is 0, the values never expire.
+// error is always nil for this implementation.
+func (c *InMemory) CompareAndSwap(keys []string, oldValues, newValues []int, expiration time.Duration) (bool, error) {
+	now := int(c.clock.Now().UnixMilli())
+
+	var expirationTime int
+	if expiration > 0 {
+		expirationTime = now + int(expiration.Milliseconds())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, key := range keys {
+		var current int
+		if entry, ok := c.cache[key]; ok && (entry.expiration == 0 || entry.expiration > now) {
+			current = entry.value
+		}
+
+		if current != oldValues[i] {
+			return false, nil
+		}
+	}
+
+	for i, key := range keys {
+		c.cache[key] = inMemoryEntry{value: newValues[i], expiration: expirationTime}
+	}
+	return true, nil
+}
+
+// LogEvents drops the timestamps older than since from the log stored at key and, if the log would not exceed limit entries, appends n timestamps at now.
+// Logs are stored in per-key ring buffers that grow on demand up to the limit, so large limits don't allocate memory for events that are never logged.
+// If expiration is 0, the log never expires.
+// error is always nil for this implementation.
+func (c *InMemory) LogEvents(key string, since, now, n, limit int, expiration time.Duration) (bool, []int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log := c.getLog(key, now)
+	if log == nil {
+		log = &inMemoryLog{}
+		c.logs[key] = log
+	}
+
+	if log.size > limit {
+		log.resize(limit)
+	}
+
+	log.dropOlderThan(since)
+
+	if n > 0 && log.size+n > limit {
+		return false, log.list(), nil
+	}
+
+	if log.size+n > len(log.timestamps) {
+		// double the capacity, so appending events one at a time doesn't copy the log each time
+		capacity := 2 * len(log.timestamps)
+		if capacity < log.size+n {
+			capacity = log.size + n
+		}
+		if capacity > limit {
+			capacity = limit
+		}
+
+		log.resize(capacity)
+	}
+
+	for i := 0; i < n; i++ {
+		log.timestamps[(log.head+log.size)%len(log.timestamps)] = now
+		log.size++
+	}
+
+	log.expiration = 0
+	if expiration > 0 {
+		log.expiration = now + int(expiration.Milliseconds())
+	}
+
+	return true, log.list(), nil
+}
+
+// EventLog returns the timestamps in the log stored at key that are not older than since, oldest first.
+// error is always nil for this implementation.
+func (c *InMemory) EventLog(key string, since int) ([]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log := c.getLog(key, int(c.clock.Now().UnixMilli()))
+	if log == nil {
+		return []int{}, nil
+	}
+
+	timestamps := log.list()
+	for len(timestamps) > 0 && timestamps[0] < since {
+		timestamps = timestamps[1:]
+	}
+	return timestamps, nil
+}
+
+// RemoveEvent removes a single timestamp equal to timestamp from the log stored at key, if there is any.
+// error is always nil for this implementation.
+func (c *InMemory) RemoveEvent(key string, timestamp int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log := c.getLog(key, int(c.clock.Now().UnixMilli()))
+	if log == nil {
+		return nil
+	}
+	log.remove(timestamp)
+	return nil
+}
+
+// getLog returns the log stored at key, or nil if it is missing or expired.
+// It must be called with the lock held.
+func (c *InMemory) getLog(key string, now int) *inMemoryLog {
+	log, ok := c.logs[key]
+	if !ok {
+		return nil
+	}
+
+	if log.expiration > 0 && log.expiration <= now {
+		delete(c.logs, key)
+		return nil
+	}
+
+	return log
+}
+
+// IncrementWithExpiration adds delta to the value stored at key and returns the new value.
+// Missing or expired keys are incremented from zero and set to expire after the given expiration, which is kept on further increments.
+// If expiration is 0, the value never expires.
+// error is always nil for this implementation.
+func (c *InMemory) IncrementWithExpiration(key string, delta int, expiration time.Duration) (int, error) {
+	now := int(c.clock.Now().UnixMilli())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[key]
+	if !ok || (entry.expiration > 0 && entry.expiration <= now) {
+		entry = inMemoryEntry{}
+		if expiration > 0 {
+			entry.expiration = now + int(expiration.Milliseconds())
+		}
 	}
 
+	entry.value += delta
+	c.cache[key] = entry
+	return entry.value, nil
+}
+
+// AdvanceWithExpiration raises the value stored at key to at least floor and adds delta to it, storing the result with the given expiration only if it does not exceed ceiling.
+// Missing or expired keys are treated as zero. If expiration is 0, the value never expires.
+// error is always nil for this implementation.
+func (c *InMemory) AdvanceWithExpiration(key string, floor, delta, ceiling int, expiration time.Duration) (int, bool, error) {
+	now := int(c.clock.Now().UnixMilli())
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+
+	var value int
+	if entry, ok := c.cache[key]; ok && (entry.expiration == 0 || entry.expiration > now) {
+		value = entry.value
+	}
+
+	if value < floor {
+		value = floor
+	}
+
+	if value+delta > ceiling {
+		return value, false, nil
+	}
+
+	var expirationTime int
+	if expiration > 0 {
+		expirationTime = now + int(expiration.Milliseconds())
+	}
+
+	value += delta
 	c.cache[key] = inMemoryEntry{value: value, expiration: expirationTime}
+	return value, true, nil
+}
+
+// Delete removes the values and event logs stored at keys. Missing keys are ignored.
+// error is always nil for this implementation.
+func (c *InMemory) Delete(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.cache, key)
+		delete(c.logs, key)
+	}
 	return nil
 }
+
+// TTL returns the time left before the value or event log stored at key expires, or 0 if it never expires.
+// error can only be nil or ErrCacheMiss for this implementation.
+func (c *InMemory) TTL(key string) (time.Duration, error) {
+	now := int(c.clock.Now().UnixMilli())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiration := -1
+	if entry, ok := c.cache[key]; ok {
+		expiration = entry.expiration
+	} else if log, ok := c.logs[key]; ok {
+		expiration = log.expiration
+	}
+
+	switch {
+	case expiration < 0 || (expiration > 0 && expiration <= now):
+		return 0, ErrCacheMiss
+	case expiration == 0:
+		return 0, nil
+	default:
+		return time.Duration(expiration-now) * time.Millisecond, nil
+	}
+}
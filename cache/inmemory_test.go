@@ -2,10 +2,12 @@ package cache_test
 
 import (
 	"errors"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/rcdmk/go-ratelimiter/cache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
 )
 
 func Test_InMemory_Cache_Can_Store_And_Retrieve_Values_For_A_Given_Key(t *testing.T) {
@@ -75,3 +77,283 @@ func Test_InMemory_Cache_Cant_Retrieve_Values_For_A_Given_Expired_Key(t *testing
 		t.Errorf("Expected value to be zero, got %d", retrievedValue)
 	}
 }
+
+func Test_InMemory_Cache_Can_Compare_And_Swap_Values_For_Given_Keys(t *testing.T) {
+	keys := []string{"test-key1", "test-key2"}
+
+	memCache := cache.NewInMemory()
+
+	// missing keys are compared as zero
+	swapped, err := memCache.CompareAndSwap(keys, []int{0, 0}, []int{42, 84}, 0)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !swapped {
+		t.Errorf("Expected values to be swapped")
+	}
+
+	swapped, _ = memCache.CompareAndSwap(keys, []int{42, 0}, []int{1, 2}, 0)
+	if swapped {
+		t.Errorf("Expected values not to be swapped when a value doesn't match")
+	}
+
+	for i, expected := range []int{42, 84} {
+		retrievedValue, _ := memCache.Get(keys[i])
+		if retrievedValue != expected {
+			t.Errorf("Expected value %d, got %d", expected, retrievedValue)
+		}
+	}
+}
+
+func Test_InMemory_Cache_Compare_And_Swap_Treats_Expired_Keys_As_Zero(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	_ = memCache.SetWithExpiration(key, 42, 2*time.Millisecond)
+	time.Sleep(3 * time.Millisecond)
+
+	swapped, _ := memCache.CompareAndSwap([]string{key}, []int{0}, []int{84}, 0)
+	if !swapped {
+		t.Errorf("Expected expired value to be swapped")
+	}
+
+	retrievedValue, _ := memCache.Get(key)
+	if retrievedValue != 84 {
+		t.Errorf("Expected value %d, got %d", 84, retrievedValue)
+	}
+}
+
+func Test_InMemory_Cache_Can_Log_Events_Up_To_A_Limit(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	logged, timestamps, err := memCache.LogEvents(key, 0, 100, 2, 3, 0)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !logged || len(timestamps) != 2 {
+		t.Errorf("Expected 2 events to be logged, got %v", timestamps)
+	}
+
+	logged, timestamps, _ = memCache.LogEvents(key, 0, 110, 2, 3, 0)
+	if logged || len(timestamps) != 2 {
+		t.Errorf("Expected events not to be logged over the limit, got %v", timestamps)
+	}
+
+	// Timestamps older than since are dropped, wrapping around the ring buffer
+	logged, timestamps, _ = memCache.LogEvents(key, 101, 120, 3, 3, 0)
+	if !logged || len(timestamps) != 3 || timestamps[0] != 120 {
+		t.Errorf("Expected 3 events to be logged after dropping old ones, got %v", timestamps)
+	}
+
+	timestamps, _ = memCache.EventLog(key, 0)
+	if len(timestamps) != 3 {
+		t.Errorf("Expected 3 events in the log, got %v", timestamps)
+	}
+}
+
+func Test_InMemory_Cache_Keeps_Newest_Events_When_Log_Limit_Shrinks(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	_, _, _ = memCache.LogEvents(key, 0, 100, 1, 3, 0)
+	_, _, _ = memCache.LogEvents(key, 0, 110, 1, 3, 0)
+	_, _, _ = memCache.LogEvents(key, 0, 120, 1, 3, 0)
+
+	_, timestamps, _ := memCache.LogEvents(key, 0, 130, 0, 2, 0)
+	if len(timestamps) != 2 || timestamps[0] != 110 || timestamps[1] != 120 {
+		t.Errorf("Expected the 2 newest events to be kept, got %v", timestamps)
+	}
+}
+
+func Test_InMemory_Cache_Grows_Event_Logs_On_Demand(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	// a log sized to the limit up front could never be allocated
+	for i := 0; i < 5; i++ {
+		logged, _, err := memCache.LogEvents(key, 0, 100+i, 1, math.MaxInt, 0)
+		if err != nil || !logged {
+			t.Errorf("Expected event to be logged, got %v and %v", logged, err)
+		}
+	}
+
+	// Growing keeps the events in order, even after wrapping around the ring buffer
+	_, _, _ = memCache.LogEvents(key, 103, 110, 0, math.MaxInt, 0)
+	_, timestamps, _ := memCache.LogEvents(key, 0, 120, 4, math.MaxInt, 0)
+
+	expected := []int{103, 104, 120, 120, 120, 120}
+	if len(timestamps) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, timestamps)
+	}
+
+	for i := range expected {
+		if timestamps[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, timestamps)
+			break
+		}
+	}
+}
+
+func Test_InMemory_Cache_Can_Increment_Values_Keeping_Expiration(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	value, err := memCache.IncrementWithExpiration(key, 2, 5*time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if value != 2 {
+		t.Errorf("Expected value %d, got %d", 2, value)
+	}
+
+	time.Sleep(3 * time.Millisecond)
+
+	// The expiration is not extended by further increments
+	value, _ = memCache.IncrementWithExpiration(key, 3, 5*time.Millisecond)
+	if value != 5 {
+		t.Errorf("Expected value %d, got %d", 5, value)
+	}
+
+	time.Sleep(3 * time.Millisecond)
+
+	_, err = memCache.Get(key)
+	if !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("Expected error %v, got %v", cache.ErrCacheMiss, err)
+	}
+}
+
+func Test_InMemory_Cache_Can_Advance_Values_Up_To_A_Ceiling(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	// Missing keys are raised to the floor
+	value, stored, err := memCache.AdvanceWithExpiration(key, 1000, 100, 1200, 0)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !stored || value != 1100 {
+		t.Errorf("Expected value %d to be stored, got %d", 1100, value)
+	}
+
+	value, stored, _ = memCache.AdvanceWithExpiration(key, 1000, 100, 1200, 0)
+	if !stored || value != 1200 {
+		t.Errorf("Expected value %d to be stored, got %d", 1200, value)
+	}
+
+	value, stored, _ = memCache.AdvanceWithExpiration(key, 1000, 100, 1200, 0)
+	if stored || value != 1200 {
+		t.Errorf("Expected value not to be stored over the ceiling, got %d", value)
+	}
+}
+
+func Test_InMemory_Cache_Can_Remove_A_Single_Event(t *testing.T) {
+	key := "test-key"
+
+	memCache := cache.NewInMemory()
+
+	_, _, _ = memCache.LogEvents(key, 0, 100, 2, 3, 0)
+	_, _, _ = memCache.LogEvents(key, 0, 110, 1, 3, 0)
+
+	_ = memCache.RemoveEvent(key, 100)
+
+	timestamps, _ := memCache.EventLog(key, 0)
+	if len(timestamps) != 2 || timestamps[0] != 100 || timestamps[1] != 110 {
+		t.Errorf("Expected a single event to be removed, got %v", timestamps)
+	}
+}
+
+func Test_InMemory_Cache_Expires_Values_With_The_Given_Clock(t *testing.T) {
+	key := "test-key"
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	memCache := cache.NewInMemory(clock)
+
+	_ = memCache.SetWithExpiration(key, 42, time.Minute)
+
+	clock.Advance(59 * time.Second)
+	if _, err := memCache.Get(key); err != nil {
+		t.Errorf("Expected value to be retrieved before expiration, got error %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := memCache.Get(key); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("Expected error %v, got %v", cache.ErrCacheMiss, err)
+	}
+}
+
+func Test_Monotonic_Clock_Advances_With_Real_Time(t *testing.T) {
+	clock := cache.NewMonotonicClock()
+
+	start := clock.Now()
+	if drift := time.Since(start); drift < 0 || drift > time.Second {
+		t.Errorf("Expected the clock to start at the current time, but it is %v apart", drift)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if elapsed := clock.Now().Sub(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected the clock to advance at least 10ms, but it advanced %v", elapsed)
+	}
+}
+
+func Test_InMemory_Cache_Can_Delete_Values_And_Event_Logs(t *testing.T) {
+	memCache := cache.NewInMemory()
+
+	_ = memCache.Set("value", 1)
+	_, _, _ = memCache.LogEvents("log", 0, 1, 1, 5, 0)
+
+	if err := memCache.Delete("value", "log", "missing"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if _, err := memCache.Get("value"); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("Expected error %v, got %v", cache.ErrCacheMiss, err)
+	}
+
+	if timestamps, _ := memCache.EventLog("log", 0); len(timestamps) != 0 {
+		t.Errorf("Expected the log to be empty, but got %v", timestamps)
+	}
+}
+
+func Test_InMemory_Cache_Reports_The_Time_To_Live_Of_Keys(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+	memCache := cache.NewInMemory(clock)
+
+	_ = memCache.Set("persistent", 1)
+	_ = memCache.SetWithExpiration("expiring", 1, time.Minute)
+	_, _, _ = memCache.LogEvents("log", 0, int(clock.Now().UnixMilli()), 1, 5, time.Hour)
+
+	clock.Advance(10 * time.Second)
+
+	tests := []struct {
+		key           string
+		expectedTTL   time.Duration
+		expectedError error
+	}{
+		{key: "persistent", expectedTTL: 0},
+		{key: "expiring", expectedTTL: 50 * time.Second},
+		{key: "log", expectedTTL: time.Hour - 10*time.Second},
+		{key: "missing", expectedError: cache.ErrCacheMiss},
+	}
+
+	for _, tt := range tests {
+		ttl, err := memCache.TTL(tt.key)
+		if !errors.Is(err, tt.expectedError) {
+			t.Errorf("Expected error %v for %s, got %v", tt.expectedError, tt.key, err)
+		}
+
+		if ttl != tt.expectedTTL {
+			t.Errorf("Expected TTL %v for %s, got %v", tt.expectedTTL, tt.key, ttl)
+		}
+	}
+}
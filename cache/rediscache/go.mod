@@ -4,7 +4,7 @@ go 1.22.1
 
 require (
 	github.com/alicebob/miniredis/v2 v2.33.0
-	github.com/rcdmk/go-ratelimiter v0.2.0
+	github.com/rcdmk/go-ratelimiter v0.3.0
 	github.com/redis/go-redis/v9 v9.5.3
 )
 
@@ -14,3 +14,7 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/yuin/gopher-lua v1.1.1 // indirect
 )
+
+// The capabilities implemented by this cache are only available in the parent module from v0.3.0 on.
+// Until it is tagged, the parent module is used from the repository. Drop this before tagging the release of this module.
+replace github.com/rcdmk/go-ratelimiter => ../../
@@ -3,15 +3,115 @@ package rediscache
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/rcdmk/go-ratelimiter/cache"
 	"github.com/redis/go-redis/v9"
 )
 
+// compareAndSwapScript compares all KEYS against the first half of ARGV, treating missing keys as zero,
+// and sets them to the second half of ARGV when all of them match. The last argument is the expiration in milliseconds.
+var compareAndSwapScript = redis.NewScript(`
+local count = #KEYS
+for i, key in ipairs(KEYS) do
+	local current = tonumber(redis.call("GET", key) or "0")
+	if current ~= tonumber(ARGV[i]) then
+		return 0
+	end
+end
+
+local expiration = tonumber(ARGV[count * 2 + 1])
+for i, key in ipairs(KEYS) do
+	if expiration > 0 then
+		redis.call("SET", key, ARGV[count + i], "PX", expiration)
+	else
+		redis.call("SET", key, ARGV[count + i])
+	end
+end
+return 1
+`)
+
+// logEventsScript drops the timestamps older than ARGV[1] from the sorted set at KEYS[1] and, if the log would not exceed ARGV[4] entries,
+// appends ARGV[3] timestamps at ARGV[2], with an expiration of ARGV[5] milliseconds.
+// It returns whether the timestamps were appended, followed by the timestamps left in the log, oldest first.
+var logEventsScript = redis.NewScript(`
+local since, now, n, limit, expiration = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", "(" .. since)
+
+local count = redis.call("ZCARD", KEYS[1])
+local logged = 0
+if n <= 0 or count + n <= limit then
+	-- members must be unique, so they are suffixed with a sequence number not used by any other member
+	local sequence = count
+	for i = 1, n do
+		repeat
+			sequence = sequence + 1
+		until not redis.call("ZSCORE", KEYS[1], ARGV[2] .. ":" .. sequence)
+		redis.call("ZADD", KEYS[1], now, ARGV[2] .. ":" .. sequence)
+	end
+
+	if expiration > 0 then
+		redis.call("PEXPIRE", KEYS[1], expiration)
+	end
+	logged = 1
+end
+
+local result = { logged }
+local entries = redis.call("ZRANGE", KEYS[1], 0, -1, "WITHSCORES")
+for i = 2, #entries, 2 do
+	table.insert(result, tonumber(entries[i]))
+end
+return result
+`)
+
+// incrementScript adds ARGV[1] to the value at KEYS[1] and, if the key has no expiration yet, sets it to expire after ARGV[2] milliseconds.
+var incrementScript = redis.NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// advanceScript raises the value at KEYS[1] to at least ARGV[1] and adds ARGV[2] to it, storing the result with an expiration of ARGV[4] milliseconds only if it does not exceed ARGV[3].
+// It returns the resulting value and whether it was stored.
+var advanceScript = redis.NewScript(`
+local floor, delta, ceiling, expiration = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+
+local value = tonumber(redis.call("GET", KEYS[1]) or "0")
+if value < floor then
+	value = floor
+end
+
+if value + delta > ceiling then
+	return { value, 0 }
+end
+
+value = value + delta
+if expiration > 0 then
+	redis.call("SET", KEYS[1], string.format("%d", value), "PX", expiration)
+else
+	redis.call("SET", KEYS[1], string.format("%d", value))
+end
+return { value, 1 }
+`)
+
+// removeEventScript removes a single member scored ARGV[1] from the sorted set at KEYS[1].
+var removeEventScript = redis.NewScript(`
+local members = redis.call("ZRANGEBYSCORE", KEYS[1], ARGV[1], ARGV[1], "LIMIT", 0, 1)
+if #members > 0 then
+	redis.call("ZREM", KEYS[1], members[1])
+end
+return #members
+`)
+
 // Redis represents a cache service that stores values in Redis.
+// It implements [cache.ContextGetterSetter], so the cancellation and deadline of a context can be passed on to Redis.
 type Redis struct {
 	client *redis.Client
+	ctx    context.Context // The context of Redis calls, set by WithContext.
 }
 
 // New creates a new ready to use InMemory cache.
@@ -21,10 +121,33 @@ func New(client *redis.Client) *Redis {
 	}
 }
 
+// WithContext returns a copy of the cache whose operations use ctx, so they are given up on when it is done.
+func (c *Redis) WithContext(ctx context.Context) cache.GetterSetter {
+	return &Redis{
+		client: c.client,
+		ctx:    ctx,
+	}
+}
+
+// callContext returns the context of Redis calls, which is the background context unless set by WithContext.
+func (c *Redis) callContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
 // Get retrieves a value from the cache.
 // error is ErrCacheMiss if key is not present in the cache.
 func (c *Redis) Get(key string) (int, error) {
-	val, err := c.client.Get(context.Background(), key).Int()
+	return c.GetContext(c.callContext(), key)
+}
+
+// GetContext retrieves a value from the cache, giving up when ctx is done.
+// error is ErrCacheMiss if key is not present in the cache.
+func (c *Redis) GetContext(ctx context.Context, key string) (int, error) {
+	val, err := c.client.Get(ctx, key).Int()
 	if err == redis.Nil {
 		return 0, cache.ErrCacheMiss
 	}
@@ -41,8 +164,125 @@ func (c *Redis) Set(key string, value int) error {
 	return c.SetWithExpiration(key, value, 0)
 }
 
+// SetContext stores a value in the cache without expiration time, giving up when ctx is done.
+func (c *Redis) SetContext(ctx context.Context, key string, value int) error {
+	return c.SetWithExpirationContext(ctx, key, value, 0)
+}
+
 // SetWithExpiration stores a value in the cache with a given expiration time.
 // If expiration is 0, the value never expires.
 func (c *Redis) SetWithExpiration(key string, value int, expiration time.Duration) error {
-	return c.client.Set(context.Background(), key, value, expiration).Err()
+	return c.SetWithExpirationContext(c.callContext(), key, value, expiration)
+}
+
+// SetWithExpirationContext stores a value in the cache with a given expiration time, giving up when ctx is done.
+// If expiration is 0, the value never expires.
+func (c *Redis) SetWithExpirationContext(ctx context.Context, key string, value int, expiration time.Duration) error {
+	return c.client.Set(ctx, key, value, expiration).Err()
+}
+
+// CompareAndSwap stores newValues for keys with the given expiration, only if all keys currently hold oldValues.
+// Missing or expired keys are compared as zero. If expiration is 0, the values never expire.
+// The check and update run atomically in a single script call, so all keys must be served by the same Redis node.
+func (c *Redis) CompareAndSwap(keys []string, oldValues, newValues []int, expiration time.Duration) (bool, error) {
+	args := make([]interface{}, 0, len(oldValues)+len(newValues)+1)
+	for _, value := range oldValues {
+		args = append(args, strconv.Itoa(value))
+	}
+	for _, value := range newValues {
+		args = append(args, strconv.Itoa(value))
+	}
+	args = append(args, expiration.Milliseconds())
+
+	swapped, err := compareAndSwapScript.Run(c.callContext(), c.client, keys, args...).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return swapped == 1, nil
+}
+
+// LogEvents drops the timestamps older than since from the log stored at key and, if the log would not exceed limit entries, appends n timestamps at now.
+// Logs are stored in sorted sets scored by timestamp and updated atomically in a single script call. If expiration is 0, the log never expires.
+func (c *Redis) LogEvents(key string, since, now, n, limit int, expiration time.Duration) (bool, []int, error) {
+	values, err := logEventsScript.Run(c.callContext(), c.client, []string{key}, since, now, n, limit, expiration.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, nil, err
+	}
+
+	timestamps := make([]int, 0, len(values)-1)
+	for _, value := range values[1:] {
+		timestamps = append(timestamps, int(value))
+	}
+
+	return values[0] == 1, timestamps, nil
+}
+
+// EventLog returns the timestamps in the log stored at key that are not older than since, oldest first.
+func (c *Redis) EventLog(key string, since int) ([]int, error) {
+	entries, err := c.client.ZRangeByScoreWithScores(c.callContext(), key, &redis.ZRangeBy{
+		Min: strconv.Itoa(since),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		timestamps = append(timestamps, int(entry.Score))
+	}
+
+	return timestamps, nil
+}
+
+// IncrementWithExpiration adds delta to the value stored at key and returns the new value.
+// Missing or expired keys are incremented from zero and set to expire after the given expiration, which is kept on further increments.
+// The increment and expiration run atomically in a single script call. If expiration is 0, the value never expires.
+func (c *Redis) IncrementWithExpiration(key string, delta int, expiration time.Duration) (int, error) {
+	return incrementScript.Run(c.callContext(), c.client, []string{key}, delta, expiration.Milliseconds()).Int()
+}
+
+// AdvanceWithExpiration raises the value stored at key to at least floor and adds delta to it, storing the result with the given expiration only if it does not exceed ceiling.
+// Missing or expired keys are treated as zero. The value is read and updated atomically in a single script call. If expiration is 0, the value never expires.
+func (c *Redis) AdvanceWithExpiration(key string, floor, delta, ceiling int, expiration time.Duration) (int, bool, error) {
+	values, err := advanceScript.Run(c.callContext(), c.client, []string{key}, floor, delta, ceiling, expiration.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int(values[0]), values[1] == 1, nil
+}
+
+// RemoveEvent removes a single timestamp equal to timestamp from the log stored at key, if there is any.
+func (c *Redis) RemoveEvent(key string, timestamp int) error {
+	return removeEventScript.Run(c.callContext(), c.client, []string{key}, timestamp).Err()
+}
+
+// Delete removes the values and event logs stored at keys in a single call. Missing keys are ignored.
+func (c *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return c.client.Del(c.callContext(), keys...).Err()
+}
+
+// TTL returns the time left before the value or event log stored at key expires, or 0 if it never expires.
+// error is ErrCacheMiss if key is not present in the cache.
+func (c *Redis) TTL(key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(c.callContext(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// PTTL replies -2 for missing keys and -1 for keys without expiration, which are returned as is
+	switch ttl {
+	case -2:
+		return 0, cache.ErrCacheMiss
+	case -1:
+		return 0, nil
+	default:
+		return ttl, nil
+	}
 }
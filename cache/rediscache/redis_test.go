@@ -1,15 +1,21 @@
 package rediscache_test
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/rcdmk/go-ratelimiter"
 	"github.com/rcdmk/go-ratelimiter/cache"
 	"github.com/rcdmk/go-ratelimiter/cache/rediscache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
 )
 
 func newMockedRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
@@ -93,3 +99,799 @@ func Test_Redis_Cache_Cant_Retrieve_Values_For_A_Given_Expired_Key(t *testing.T)
 		t.Errorf("Expected value to be zero, got %d", retrievedValue)
 	}
 }
+
+func Test_Redis_Cache_Can_Compare_And_Swap_Values_For_Given_Keys(t *testing.T) {
+	keys := []string{"test-key1", "test-key2"}
+
+	redisClient, _ := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	var _ cache.CompareAndSwapper = memCache
+
+	// missing keys are compared as zero
+	swapped, err := memCache.CompareAndSwap(keys, []int{0, 0}, []int{42, 84}, 0)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !swapped {
+		t.Errorf("Expected values to be swapped")
+	}
+
+	swapped, _ = memCache.CompareAndSwap(keys, []int{42, 0}, []int{1, 2}, 0)
+	if swapped {
+		t.Errorf("Expected values not to be swapped when a value doesn't match")
+	}
+
+	for i, expected := range []int{42, 84} {
+		retrievedValue, _ := memCache.Get(keys[i])
+		if retrievedValue != expected {
+			t.Errorf("Expected value %d, got %d", expected, retrievedValue)
+		}
+	}
+}
+
+func Test_Redis_Cache_Compare_And_Swap_Sets_Expiration(t *testing.T) {
+	key := "test-key"
+
+	redisClient, miniRedis := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	_, _ = memCache.CompareAndSwap([]string{key}, []int{0}, []int{42}, 2*time.Millisecond)
+	miniRedis.FastForward(3 * time.Millisecond)
+
+	_, err := memCache.Get(key)
+	if !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("Expected error %v, got %v", cache.ErrCacheMiss, err)
+	}
+}
+
+func Test_Redis_Cache_Does_Not_Let_Rate_Limiter_Overspend_Under_Concurrency(t *testing.T) {
+	sourceKey := "test"
+	maxBurst := 50
+
+	redisClient, _ := newMockedRedis(t)
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         maxBurst,
+		Cache:            rediscache.New(redisClient),
+	})
+
+	var allowed int64
+	var wg sync.WaitGroup
+
+	// 20 goroutines competing for the same bucket
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if limiter.Allow(sourceKey) {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// one extra token may be refilled while the test runs
+	if allowed < int64(maxBurst) || allowed > int64(maxBurst+1) {
+		t.Errorf("Expected limiter to allow %d events, but it allowed %d", maxBurst, allowed)
+	}
+}
+
+func Test_Redis_Cache_Consumes_All_Bandwidths_Atomically(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(30, time.Minute), MaxBurst: 30},
+			{Rate: ratelimiter.Per(20, time.Hour), MaxBurst: 20},
+		},
+		Cache: rediscache.New(redisClient),
+	}
+
+	// two instances sharing the same bands
+	limiter1 := ratelimiter.New(options)
+	limiter2 := ratelimiter.New(options)
+
+	var allowed int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(limiter *ratelimiter.RateLimiter) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if limiter.Allow(sourceKey) {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}([]*ratelimiter.RateLimiter{limiter1, limiter2}[i%2])
+	}
+	wg.Wait()
+
+	if allowed != 20 {
+		t.Errorf("Expected limiters to allow 20 events, but they allowed %d", allowed)
+	}
+
+	// the hourly band is the one exhausted
+	result, _ := limiter1.Decide(sourceKey)
+	if result.Band != 1 {
+		t.Errorf("Expected the hourly band to bind the decision, but got band %d", result.Band)
+	}
+}
+
+func Test_Redis_Cache_Consumes_All_Hierarchy_Levels_Atomically(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.HierarchyOptions{
+		Levels: []ratelimiter.Level{
+			{Rate: ratelimiter.Per(10, time.Minute), MaxBurst: 10},
+			{Rate: ratelimiter.Per(15, time.Hour), MaxBurst: 15},
+		},
+		Parent: func(sourceKey string) (string, bool) {
+			return "org", true
+		},
+		Cache: rediscache.New(redisClient),
+	}
+
+	// two instances sharing the same levels
+	limiter1 := ratelimiter.NewHierarchy(options)
+	limiter2 := ratelimiter.NewHierarchy(options)
+
+	var allowed int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(limiter *ratelimiter.HierarchicalLimiter, sourceKey string) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if limiter.Allow(sourceKey) {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}([]*ratelimiter.HierarchicalLimiter{limiter1, limiter2}[i%2], []string{"user1", "user2", "user3"}[i%3])
+	}
+	wg.Wait()
+
+	if allowed != 15 {
+		t.Errorf("Expected limiters to allow 15 events, but they allowed %d", allowed)
+	}
+}
+
+func Test_Redis_Cache_Shares_Rate_Limiter_Reservations_Between_Instances(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Cache:            rediscache.New(redisClient),
+	}
+	limiter1 := ratelimiter.New(options)
+	limiter2 := ratelimiter.New(options)
+
+	_ = limiter1.Reserve(sourceKey, 5)
+
+	reservation := limiter1.Reserve(sourceKey, 2)
+	if !reservation.OK() {
+		t.Fatalf("Expected reservation to be OK, but it wasn't")
+	}
+
+	// The bucket is in debt for both instances
+	if limiter2.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	reservation.Cancel()
+
+	// Only the first reservation is left, so the bucket is empty but not in debt
+	if delay := limiter2.Reserve(sourceKey, 1).Delay(); delay > 100*time.Millisecond || delay < 50*time.Millisecond {
+		t.Errorf("Expected a delay of around 100ms, got %v", delay)
+	}
+}
+
+func Test_Redis_Cache_Can_Log_Events_Up_To_A_Limit(t *testing.T) {
+	key := "test-key"
+
+	redisClient, _ := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	var _ cache.EventLogger = memCache
+
+	logged, timestamps, err := memCache.LogEvents(key, 0, 100, 2, 3, time.Second)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !logged || len(timestamps) != 2 {
+		t.Errorf("Expected 2 events to be logged, got %v", timestamps)
+	}
+
+	logged, timestamps, _ = memCache.LogEvents(key, 0, 110, 2, 3, time.Second)
+	if logged || len(timestamps) != 2 {
+		t.Errorf("Expected events not to be logged over the limit, got %v", timestamps)
+	}
+
+	// Timestamps older than since are dropped
+	logged, timestamps, _ = memCache.LogEvents(key, 101, 120, 3, 3, time.Second)
+	if !logged || len(timestamps) != 3 || timestamps[0] != 120 {
+		t.Errorf("Expected 3 events to be logged after dropping old ones, got %v", timestamps)
+	}
+
+	timestamps, _ = memCache.EventLog(key, 0)
+	if len(timestamps) != 3 {
+		t.Errorf("Expected 3 events in the log, got %v", timestamps)
+	}
+}
+
+func Test_Redis_Cache_Sliding_Window_Log_Is_Shared_Between_Instances(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         5,
+		Cache:            rediscache.New(redisClient),
+		Algorithm:        ratelimiter.SlidingWindowLog,
+	}
+	limiter1 := ratelimiter.New(options)
+	limiter2 := ratelimiter.New(options)
+
+	for i := 0; i < 5; i++ {
+		if !limiter1.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	if limiter2.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter2.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining events, got %d", 0, remaining)
+	}
+}
+
+func Test_Redis_Cache_Can_Increment_Values_Keeping_Expiration(t *testing.T) {
+	key := "test-key"
+
+	redisClient, miniRedis := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	var _ cache.Incrementer = memCache
+
+	value, err := memCache.IncrementWithExpiration(key, 2, 5*time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if value != 2 {
+		t.Errorf("Expected value %d, got %d", 2, value)
+	}
+
+	miniRedis.FastForward(3 * time.Millisecond)
+
+	// The expiration is not extended by further increments
+	value, _ = memCache.IncrementWithExpiration(key, 3, 5*time.Millisecond)
+	if value != 5 {
+		t.Errorf("Expected value %d, got %d", 5, value)
+	}
+
+	miniRedis.FastForward(3 * time.Millisecond)
+
+	_, err = memCache.Get(key)
+	if !errors.Is(err, cache.ErrCacheMiss) {
+		t.Errorf("Expected error %v, got %v", cache.ErrCacheMiss, err)
+	}
+}
+
+func Test_Redis_Cache_Can_Advance_Values_Up_To_A_Ceiling(t *testing.T) {
+	key := "test-key"
+	now := int(time.Now().UnixMicro())
+
+	redisClient, _ := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	var _ cache.Advancer = memCache
+
+	// Missing keys are raised to the floor
+	value, stored, err := memCache.AdvanceWithExpiration(key, now, 100, now+200, time.Second)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !stored || value != now+100 {
+		t.Errorf("Expected value %d to be stored, got %d", now+100, value)
+	}
+
+	value, stored, _ = memCache.AdvanceWithExpiration(key, now, 100, now+200, time.Second)
+	if !stored || value != now+200 {
+		t.Errorf("Expected value %d to be stored, got %d", now+200, value)
+	}
+
+	value, stored, _ = memCache.AdvanceWithExpiration(key, now, 100, now+200, time.Second)
+	if stored || value != now+200 {
+		t.Errorf("Expected value not to be stored over the ceiling, got %d", value)
+	}
+
+	retrievedValue, _ := memCache.Get(key)
+	if retrievedValue != now+200 {
+		t.Errorf("Expected value %d, got %d", now+200, retrievedValue)
+	}
+}
+
+func Test_Redis_Cache_Runs_GCRA_In_A_Single_Call(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, miniRedis := newMockedRedis(t)
+
+	counter := &commandCounter{}
+	redisClient.AddHook(counter)
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Cache:            rediscache.New(redisClient),
+		Algorithm:        ratelimiter.GCRA,
+	})
+
+	// warm up the script cache
+	_ = limiter.Allow(sourceKey)
+
+	calls := atomic.LoadInt64(&counter.count)
+	for i := 0; i < 4; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if calls = atomic.LoadInt64(&counter.count) - calls; calls != 5 {
+		t.Errorf("Expected a single Redis call per event, got %d calls for 5 events", calls)
+	}
+
+	if keys := miniRedis.Keys(); len(keys) != 1 {
+		t.Errorf("Expected a single key to be stored, got %v", keys)
+	}
+}
+
+func Test_Redis_Cache_Expires_GCRA_State_At_High_Rates(t *testing.T) {
+	redisClient, miniRedis := newMockedRedis(t)
+
+	// a full burst takes half a millisecond, shorter than the expiration resolution of Redis
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:      ratelimiter.Per(10000, time.Second),
+		MaxBurst:  5,
+		Cache:     rediscache.New(redisClient),
+		Algorithm: ratelimiter.GCRA,
+	})
+
+	if !limiter.Allow("test") {
+		t.Errorf("Expected limiter to allow event, but it didn't")
+	}
+
+	for _, key := range miniRedis.Keys() {
+		if ttl := miniRedis.TTL(key); ttl <= 0 {
+			t.Errorf("Expected key %s to expire, but its TTL is %v", key, ttl)
+		}
+	}
+}
+
+// commandCounter is a Redis client hook that counts the commands sent to Redis.
+type commandCounter struct {
+	count int64
+}
+
+func (c *commandCounter) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (c *commandCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		atomic.AddInt64(&c.count, 1)
+		return next(ctx, cmd)
+	}
+}
+
+func (c *commandCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func Test_Redis_Cache_Can_Remove_A_Single_Event(t *testing.T) {
+	key := "test-key"
+
+	redisClient, _ := newMockedRedis(t)
+	memCache := rediscache.New(redisClient)
+
+	_, _, _ = memCache.LogEvents(key, 0, 100, 2, 3, 0)
+	_ = memCache.RemoveEvent(key, 100)
+
+	// Events logged after a removal are not merged with existing ones
+	_, timestamps, _ := memCache.LogEvents(key, 0, 100, 2, 3, 0)
+	if len(timestamps) != 3 {
+		t.Errorf("Expected 3 events in the log, got %v", timestamps)
+	}
+}
+
+func Test_Redis_Cache_Shares_Concurrency_Leases_Between_Instances(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 1,
+		Cache:         rediscache.New(redisClient),
+	}
+	limiter1 := ratelimiter.NewConcurrency(options)
+	limiter2 := ratelimiter.NewConcurrency(options)
+
+	lease, err := limiter1.TryAcquire(sourceKey)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err = limiter2.TryAcquire(sourceKey); !errors.Is(err, ratelimiter.ErrConcurrencyLimitReached) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrConcurrencyLimitReached, err)
+	}
+
+	lease.Release()
+
+	if _, err = limiter2.TryAcquire(sourceKey); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func Test_Redis_Cache_Errors_Follow_The_Failure_Policy(t *testing.T) {
+	sourceKey := "test"
+
+	redisClient, miniRedis := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         2,
+		Cache:            rediscache.New(redisClient),
+	}
+
+	options.FailurePolicy = ratelimiter.FailClosed
+	closedLimiter := ratelimiter.New(options)
+
+	options.FailurePolicy = ratelimiter.FailLocal
+	localLimiter := ratelimiter.New(options)
+
+	miniRedis.Close()
+
+	if allowed, err := closedLimiter.AllowE(sourceKey); allowed || err == nil {
+		t.Errorf("Expected fail-closed limiter to deny the event with an error, but got %t and %v", allowed, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := localLimiter.AllowE(sourceKey); !allowed || err == nil {
+			t.Errorf("Expected fail-local limiter to allow the event with an error, but got %t and %v", allowed, err)
+		}
+	}
+
+	if localLimiter.Allow(sourceKey) {
+		t.Errorf("Expected fail-local limiter to rate-limit event, but it didn't")
+	}
+}
+
+func Test_Redis_Cache_Gives_Up_On_Slow_Calls_When_The_Context_Is_Done(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+	redisClient.AddHook(&slowHook{delay: time.Second})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         2,
+		Cache:            rediscache.New(redisClient),
+		FailurePolicy:    ratelimiter.FailClosed,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := limiter.DecideCtx(ctx, "test")
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected limiter to give up on Redis at the context deadline, but it took %v", elapsed)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, but got %v", err)
+	}
+
+	if result.Allowed {
+		t.Errorf("Expected fail-closed limiter to deny the event, but it didn't")
+	}
+}
+
+func Test_Redis_Cache_Honours_The_Context_Of_Resets_And_Leases(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         2,
+		Cache:            rediscache.New(redisClient),
+	})
+
+	concurrencyLimiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 1,
+		Cache:         rediscache.New(redisClient),
+	})
+
+	lease, err := concurrencyLimiter.TryAcquire("test")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := limiter.ResetCtx(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error, but got %v", err)
+	}
+
+	// the lease is only given back when it expires
+	lease.ReleaseCtx(ctx)
+	if inFlight := concurrencyLimiter.InFlight("test"); inFlight != 1 {
+		t.Errorf("Expected %d lease in flight, got %d", 1, inFlight)
+	}
+
+	// Acquire gives up on slow calls at the context deadline, acquiring the lease as cache operations failed
+	redisClient.AddHook(&slowHook{delay: time.Second})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := concurrencyLimiter.Acquire(ctx, "test"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected limiter to give up on Redis at the context deadline, but it took %v", elapsed)
+	}
+}
+
+func Test_Redis_Cache_Uses_The_Context_It_Is_Bound_To(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+	redisCache := rediscache.New(redisClient)
+
+	if err := redisCache.SetContext(context.Background(), "test-key", 1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := redisCache.WithContext(ctx).Get("test-key"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error from the bound cache, but got %v", err)
+	}
+
+	if value, err := redisCache.Get("test-key"); err != nil || value != 1 {
+		t.Errorf("Expected the original cache to be unaffected, but got %d and %v", value, err)
+	}
+}
+
+// slowHook is a Redis client hook that delays every command, giving up when the context is done like a slow network would.
+type slowHook struct {
+	delay time.Duration
+}
+
+func (h *slowHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *slowHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		timer := time.NewTimer(h.delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return next(ctx, cmd)
+		}
+	}
+}
+
+func (h *slowHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func Test_Redis_Cache_Can_Delete_Keys_And_Report_Their_Time_To_Live(t *testing.T) {
+	redisClient, miniRedis := newMockedRedis(t)
+	redisCache := rediscache.New(redisClient)
+
+	_ = redisCache.Set("persistent", 1)
+	_ = redisCache.SetWithExpiration("expiring", 1, time.Minute)
+
+	miniRedis.FastForward(10 * time.Second)
+
+	if ttl, err := redisCache.TTL("persistent"); err != nil || ttl != 0 {
+		t.Errorf("Expected no expiration, but got %v and %v", ttl, err)
+	}
+
+	if ttl, err := redisCache.TTL("expiring"); err != nil || ttl != 50*time.Second {
+		t.Errorf("Expected TTL to be 50s, but got %v and %v", ttl, err)
+	}
+
+	if err := redisCache.Delete("persistent", "expiring", "missing"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	for _, key := range []string{"persistent", "expiring"} {
+		if _, err := redisCache.TTL(key); !errors.Is(err, cache.ErrCacheMiss) {
+			t.Errorf("Expected error %v for %s, but got %v", cache.ErrCacheMiss, key, err)
+		}
+	}
+}
+
+func Test_Redis_Cache_Supports_Rate_Limiter_Administration(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         5,
+		Cache:            rediscache.New(redisClient),
+	})
+
+	if err := limiter.Set("test", 0); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if limiter.Allow("test") {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	state, err := limiter.Inspect("test")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if state.Bucket != 0 || state.LastFill.IsZero() || state.TTL <= 0 || state.TTL > 10*time.Second {
+		t.Errorf("Expected an empty bucket expiring within 10 seconds, but got %+v", state)
+	}
+
+	if err := limiter.Reset("test"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if remaining := limiter.Remaining("test"); remaining != 5 {
+		t.Errorf("Expected 5 remaining events after reset, but got %d", remaining)
+	}
+}
+
+func Test_Redis_Cache_Shares_Bans_Between_Instances(t *testing.T) {
+	redisClient, _ := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Cache:            rediscache.New(redisClient),
+		Penalty:          ratelimiter.Penalty{BanDuration: time.Hour},
+	}
+
+	limiter1 := ratelimiter.New(options)
+	limiter2 := ratelimiter.New(options)
+
+	if err := limiter1.Ban("test", time.Hour); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if result, _ := limiter2.Decide("test"); result.Allowed || !result.Banned {
+		t.Errorf("Expected the ban to be shared, but got %+v", result)
+	}
+
+	if err := limiter2.Unban("test"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if !limiter1.Allow("test") {
+		t.Errorf("Expected the unban to be shared, but the event was denied")
+	}
+}
+
+func Test_Redis_Cache_Keeps_Quota_Counters_Until_The_Period_Ends(t *testing.T) {
+	redisClient, miniRedis := newMockedRedis(t)
+
+	options := ratelimiter.QuotaOptions{
+		Limit:  3,
+		Period: ratelimiter.Monthly,
+		Cache:  rediscache.New(redisClient),
+	}
+
+	// two instances sharing the same counters
+	quota1 := ratelimiter.NewQuota(options)
+	quota2 := ratelimiter.NewQuota(options)
+
+	for i := 0; i < 3; i++ {
+		if !quota1.Allow("customer") {
+			t.Fatalf("Expected event %d to be allowed, but it wasn't", i+1)
+		}
+	}
+
+	if quota2.Allow("customer") {
+		t.Errorf("Expected the quota to be shared, but it wasn't")
+	}
+
+	keys := miniRedis.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("Expected a single counter, but got keys %v", keys)
+	}
+
+	// the month end is measured after the counter was written, so allow for the time elapsed since
+	ttl := miniRedis.TTL(keys[0])
+	if ttl <= 0 || ttl > time.Until(quota1.ResetAt())+time.Second {
+		t.Errorf("Expected the counter to expire when the month ends, in %v, but got %v", time.Until(quota1.ResetAt()), ttl)
+	}
+
+	if used, err := quota2.Used("customer"); err != nil || used != 3 {
+		t.Errorf("Expected 3 events used, but got %d, %v", used, err)
+	}
+}
+
+func Test_Redis_Cache_Expires_Quota_Counters_Near_The_Period_End(t *testing.T) {
+	redisClient, miniRedis := newMockedRedis(t)
+
+	// less than a millisecond before the day ends
+	clock := ratelimitertest.NewClock(time.Date(2024, time.January, 10, 23, 59, 59, 999_500_000, time.UTC))
+
+	quota := ratelimiter.NewQuota(ratelimiter.QuotaOptions{
+		Limit:  3,
+		Period: ratelimiter.Daily,
+		Cache:  rediscache.New(redisClient),
+		Clock:  clock,
+	})
+
+	if !quota.Allow("customer") {
+		t.Fatalf("Expected event to be allowed, but it wasn't")
+	}
+
+	for _, key := range miniRedis.Keys() {
+		if ttl := miniRedis.TTL(key); ttl <= 0 {
+			t.Errorf("Expected key %s to expire, but got TTL %v", key, ttl)
+		}
+	}
+}
+
+func Test_Redis_Cache_Namespaces_Isolate_Limiters(t *testing.T) {
+	redisClient, miniRedis := newMockedRedis(t)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Cache:            rediscache.New(redisClient),
+		Namespace:        "product-a",
+	}
+	limiterA := ratelimiter.New(options)
+
+	options.Namespace = "product-b"
+	limiterB := ratelimiter.New(options)
+
+	if !limiterA.Allow("test") || limiterA.Allow("test") {
+		t.Fatalf("Expected only the first event to be allowed in product-a")
+	}
+
+	if !limiterB.Allow("test") {
+		t.Errorf("Expected the event to be allowed in product-b, but it wasn't")
+	}
+
+	for _, key := range miniRedis.Keys() {
+		if !strings.HasPrefix(key, "product-a:rl:") && !strings.HasPrefix(key, "product-b:rl:") {
+			t.Errorf("Expected every key to be in a namespace, but got %q", key)
+		}
+	}
+}
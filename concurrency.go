@@ -0,0 +1,190 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// ErrConcurrencyLimitReached is returned when a lease cannot be acquired because the maximum number of concurrent leases is held.
+var ErrConcurrencyLimitReached = errors.New("ratelimiter: concurrency limit reached")
+
+const (
+	leaseKeyPrefix = "rl:lease:"
+
+	// acquirePollInterval is the maximum time to wait before trying to acquire a lease again, as leases released by other instances are not notified.
+	acquirePollInterval = 50 * time.Millisecond
+)
+
+// ConcurrencyLimiter represents a limiter for the number of events in flight at the same time, using leases that must be released when the event is done.
+// Leases are stored in the cache, so they are shared by all limiters using it, and expire so a crashed holder cannot keep them forever.
+// It requires a cache implementing [cache.EventLogger], otherwise leases can't be acquired and ErrUnsupportedCache is returned.
+type ConcurrencyLimiter struct {
+	maxConcurrent int                // The maximum number of leases held at the same time.
+	leaseTTL      time.Duration      // The time after which a lease expires if not released.
+	cache         cache.GetterSetter // Cache to store the leases.
+	clock         Clock              // Clock to read the current time from.
+	keys          keySpace           // Builds the cache keys of the limiter.
+}
+
+// Lease represents a slot held in a ConcurrencyLimiter, that must be released when the event is done.
+type Lease struct {
+	limiter    *ConcurrencyLimiter
+	sourceKey  string
+	acquiredAt int // Unix time in milliseconds when the lease was acquired.
+
+	once sync.Once
+}
+
+// Release gives the slot back to the limiter. Calling Release more than once has no effect.
+// If cache operations fail, the slot is given back when the lease expires.
+func (l *Lease) Release() {
+	l.ReleaseCtx(context.Background())
+}
+
+// ReleaseCtx works like Release, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+// The lease is released at most once, even if cache operations fail because ctx is done.
+func (l *Lease) ReleaseCtx(ctx context.Context) {
+	l.once.Do(func() {
+		if logger, ok := l.limiter.cacheFor(ctx).(cache.EventLogger); ok {
+			_ = logger.RemoveEvent(l.limiter.getLeaseKeyFor(l.sourceKey), l.acquiredAt)
+		}
+	})
+}
+
+// ExpiresAt returns the time when the lease expires if not released.
+func (l *Lease) ExpiresAt() time.Time {
+	return time.UnixMilli(int64(l.acquiredAt)).Add(l.limiter.leaseTTL)
+}
+
+func (cl *ConcurrencyLimiter) getLeaseKeyFor(sourceKey string) string {
+	return cl.keys.keyFor(leaseKeyPrefix, sourceKey)
+}
+
+// cacheFor returns the cache bound to ctx, like withContext.
+func (cl *ConcurrencyLimiter) cacheFor(ctx context.Context) cache.GetterSetter {
+	return withContext(cl.cache, ctx)
+}
+
+// TryAcquire acquires a lease for a particular key without blocking.
+// It returns ErrConcurrencyLimitReached if the maximum number of leases is held, or ErrUnsupportedCache if the cache does not implement [cache.EventLogger].
+// If cache operations fail, the lease is always acquired.
+func (cl *ConcurrencyLimiter) TryAcquire(sourceKey string) (*Lease, error) {
+	lease, _, err := cl.tryAcquire(context.Background(), sourceKey)
+	return lease, err
+}
+
+// Acquire acquires a lease for a particular key, blocking until one is available.
+// It returns an error if the context is cancelled or its deadline is exceeded, or ErrUnsupportedCache right away if the cache does not implement [cache.EventLogger].
+// Cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+// If cache operations fail, the lease is always acquired.
+// Polling for a lease sleeps on real time and ignores the clock of the limiter, so a fake clock only affects when stale leases expire.
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context, sourceKey string) (*Lease, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		lease, wait, err := cl.tryAcquire(ctx, sourceKey)
+		if err != ErrConcurrencyLimitReached {
+			return lease, err
+		}
+
+		// leases can be released before they expire, so check again from time to time
+		if wait > acquirePollInterval {
+			wait = acquirePollInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryAcquire acquires a lease for a particular key if there are fewer than maxConcurrent leases held.
+// When no lease is available, it returns the time until the oldest lease expires.
+func (cl *ConcurrencyLimiter) tryAcquire(ctx context.Context, sourceKey string) (*Lease, time.Duration, error) {
+	now := int(cl.clock.Now().UnixMilli())
+	lease := &Lease{limiter: cl, sourceKey: sourceKey, acquiredAt: now}
+
+	logger, ok := cl.cacheFor(ctx).(cache.EventLogger)
+	if !ok {
+		return nil, 0, ErrUnsupportedCache
+	}
+
+	ttl := int(cl.leaseTTL.Milliseconds())
+
+	acquired, leases, err := logger.LogEvents(cl.getLeaseKeyFor(sourceKey), now-ttl+1, now, 1, cl.maxConcurrent, cl.leaseTTL)
+	if err != nil {
+		// if cache fails, there are never leases held. Let the event be executed
+		return lease, 0, nil
+	}
+
+	if !acquired {
+		wait := time.Duration(ttl) * time.Millisecond
+		if len(leases) > 0 {
+			wait = time.Duration(leases[0]+ttl-now) * time.Millisecond
+		}
+		return nil, wait, ErrConcurrencyLimitReached
+	}
+
+	return lease, 0, nil
+}
+
+// InFlight returns the number of leases held for a particular key.
+// If cache operations fail or the cache does not implement [cache.EventLogger], it will always return zero.
+func (cl *ConcurrencyLimiter) InFlight(sourceKey string) int {
+	logger, ok := cl.cache.(cache.EventLogger)
+	if !ok {
+		return 0
+	}
+
+	now := int(cl.clock.Now().UnixMilli())
+
+	leases, err := logger.EventLog(cl.getLeaseKeyFor(sourceKey), now-int(cl.leaseTTL.Milliseconds())+1)
+	if err != nil {
+		return 0
+	}
+
+	return len(leases)
+}
+
+// ConcurrencyOptions represents the options for configuring a ConcurrencyLimiter.
+type ConcurrencyOptions struct {
+	MaxConcurrent int                // The maximum number of leases held at the same time for each key.
+	LeaseTTL      time.Duration      // The time after which a lease expires if not released. Default is 1 minute.
+	Cache         cache.GetterSetter // The cache to store the leases. If not provided, an in-memory cache will be used.
+	Clock         Clock              // The clock to read the current time from. Default is a monotonic clock.
+	Namespace     string             // Prefixes the cache keys of the limiter, so limiters with different limits can share a cache.
+	KeyBuilder    KeyBuilder         // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is DefaultKeyBuilder.
+}
+
+// NewConcurrency creates a new ready to use ConcurrencyLimiter with the specified options.
+func NewConcurrency(options ConcurrencyOptions) *ConcurrencyLimiter {
+	if options.Clock == nil {
+		options.Clock = cache.NewMonotonicClock()
+	}
+
+	if options.Cache == nil {
+		options.Cache = cache.NewInMemory(options.Clock)
+	}
+
+	if options.LeaseTTL == 0 {
+		options.LeaseTTL = time.Minute
+	}
+
+	return &ConcurrencyLimiter{
+		maxConcurrent: options.MaxConcurrent,
+		leaseTTL:      options.LeaseTTL,
+		cache:         options.Cache,
+		clock:         options.Clock,
+		keys:          newKeySpace(options.Namespace, options.KeyBuilder),
+	}
+}
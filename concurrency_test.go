@@ -0,0 +1,159 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+)
+
+func TestConcurrencyLimiter_TryAcquire(t *testing.T) {
+	sourceKey := "test"
+
+	limiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 2,
+	})
+
+	lease1, err := limiter.TryAcquire(sourceKey)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = limiter.TryAcquire(sourceKey)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = limiter.TryAcquire(sourceKey)
+	if !errors.Is(err, ratelimiter.ErrConcurrencyLimitReached) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrConcurrencyLimitReached, err)
+	}
+
+	if inFlight := limiter.InFlight(sourceKey); inFlight != 2 {
+		t.Errorf("Expected %d leases in flight, got %d", 2, inFlight)
+	}
+
+	lease1.Release()
+	lease1.Release()
+
+	if inFlight := limiter.InFlight(sourceKey); inFlight != 1 {
+		t.Errorf("Expected %d lease in flight, got %d", 1, inFlight)
+	}
+
+	if _, err = limiter.TryAcquire(sourceKey); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter_Leases_Expire(t *testing.T) {
+	sourceKey := "test"
+
+	limiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 1,
+		LeaseTTL:      50 * time.Millisecond,
+	})
+
+	// The holder never releases the lease
+	_, _ = limiter.TryAcquire(sourceKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := limiter.Acquire(ctx, sourceKey); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected to wait for the lease to expire, but waited %v", elapsed)
+	}
+}
+
+func TestConcurrencyLimiter_Acquire_Honours_Context_Cancellation(t *testing.T) {
+	sourceKey := "test"
+
+	limiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 1,
+	})
+
+	_, _ = limiter.TryAcquire(sourceKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := limiter.Acquire(ctx, sourceKey)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestConcurrencyLimiter_Requires_An_Event_Logger(t *testing.T) {
+	sourceKey := "test"
+
+	limiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: 1,
+		Cache:         &mockGetterSetterCache{values: map[string]int{}},
+	})
+
+	if _, err := limiter.TryAcquire(sourceKey); !errors.Is(err, ratelimiter.ErrUnsupportedCache) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrUnsupportedCache, err)
+	}
+
+	// Acquire fails right away, as waiting would never help
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := limiter.Acquire(ctx, sourceKey); !errors.Is(err, ratelimiter.ErrUnsupportedCache) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrUnsupportedCache, err)
+	}
+
+	if inFlight := limiter.InFlight(sourceKey); inFlight != 0 {
+		t.Errorf("Expected %d leases in flight, got %d", 0, inFlight)
+	}
+}
+
+func TestConcurrencyLimiter_Limits_In_Flight_Events(t *testing.T) {
+	sourceKey := "test"
+	maxConcurrent := 5
+
+	limiter := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{
+		MaxConcurrent: maxConcurrent,
+	})
+
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			lease, err := limiter.Acquire(context.Background(), sourceKey)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			defer lease.Release()
+
+			current := atomic.AddInt64(&inFlight, 1)
+			for {
+				seen := atomic.LoadInt64(&maxInFlight)
+				if current <= seen || atomic.CompareAndSwapInt64(&maxInFlight, seen, current) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > int64(maxConcurrent) {
+		t.Errorf("Expected at most %d events in flight, got %d", maxConcurrent, maxInFlight)
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// ErrUnsupportedCache is returned when the cache does not implement the capability required by the algorithm, such as [cache.EventLogger] for SlidingWindowLog.
+var ErrUnsupportedCache = errors.New("ratelimiter: cache does not support the algorithm")
+
+// FailurePolicy represents how a RateLimiter decides when cache operations fail.
+type FailurePolicy int
+
+const (
+	// FailOpen allows every event while the cache fails, reporting a full bucket. This is the default policy.
+	FailOpen FailurePolicy = iota
+	// FailClosed denies every event while the cache fails, reporting an empty bucket.
+	FailClosed
+	// FailLocal falls back to a limiter with the same options and a local in-memory cache while the cache fails.
+	// Limits are then applied per instance instead of being shared through the cache.
+	FailLocal
+)
+
+// newFallback creates the local limiter used while the cache fails, when the failure policy is FailLocal.
+func newFallback(options Options) *RateLimiter {
+	if options.FailurePolicy != FailLocal {
+		return nil
+	}
+
+	options.Cache = cache.NewInMemory(options.Clock)
+	options.FailurePolicy = FailOpen
+
+	return New(options)
+}
+
+// cacheError wraps an error returned by cache operations, so callers can tell it apart from decision errors.
+func cacheError(err error) error {
+	if errors.Is(err, ErrUnsupportedCache) {
+		return err
+	}
+
+	return fmt.Errorf("ratelimiter: cache operation failed: %w", err)
+}
+
+// failedTake decides on n tokens for a particular key according to the failure policy, after cache operations failed.
+func (rl *RateLimiter) failedTake(ctx context.Context, sourceKey string, n int) Result {
+	switch rl.failurePolicy {
+	case FailClosed:
+		// retry once the rate would have allowed another event, the cache may be back by then
+		return Result{Limit: rl.rate.Events, RetryAfter: rl.rate.TimeFor(1)}
+	case FailLocal:
+		rl.fallback.mu.RLock()
+		defer rl.fallback.mu.RUnlock()
+
+		result, _ := rl.fallback.take(ctx, sourceKey, n)
+		return result
+	default:
+		return Result{Allowed: true, Remaining: rl.maxBurst, Limit: rl.rate.Events}
+	}
+}
+
+// failedRemaining returns the number of tokens available for a particular key according to the failure policy, after cache operations failed.
+func (rl *RateLimiter) failedRemaining(sourceKey string) int {
+	switch rl.failurePolicy {
+	case FailClosed:
+		return 0
+	case FailLocal:
+		return rl.fallback.Remaining(sourceKey)
+	default:
+		return rl.maxBurst
+	}
+}
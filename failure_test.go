@@ -0,0 +1,224 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+func TestRateLimiter_FailurePolicy(t *testing.T) {
+	sourceKey := "test"
+
+	tests := []struct {
+		name            string
+		failurePolicy   ratelimiter.FailurePolicy
+		expectedAllowed int
+	}{
+		{name: "fail open", failurePolicy: ratelimiter.FailOpen, expectedAllowed: 10},
+		{name: "fail closed", failurePolicy: ratelimiter.FailClosed, expectedAllowed: 0},
+		// the local limiter still applies the burst
+		{name: "fail local", failurePolicy: ratelimiter.FailLocal, expectedAllowed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimiter.New(ratelimiter.Options{
+				Rate:          ratelimiter.Per(1, time.Minute),
+				MaxBurst:      3,
+				Cache:         &mockFailedCache{},
+				FailurePolicy: tt.failurePolicy,
+			})
+
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				ok, err := limiter.AllowE(sourceKey)
+				if err == nil {
+					t.Errorf("Expected the cache error, but got nil")
+				}
+
+				if ok {
+					allowed++
+				}
+			}
+
+			if allowed != tt.expectedAllowed {
+				t.Errorf("Expected limiter to allow %d events, but it allowed %d", tt.expectedAllowed, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Decide_Returns_Cache_Errors(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         3,
+		Cache:            &mockFailedWritesCache{},
+		FailurePolicy:    ratelimiter.FailClosed,
+	})
+
+	result, err := limiter.Decide("test")
+	if !errors.Is(err, errMockWrite) {
+		t.Errorf("Expected the cache write error, but got %v", err)
+	}
+
+	if result.Allowed {
+		t.Errorf("Expected limiter to deny the event, but it didn't")
+	}
+
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected retry after to be 1s, but got %v", result.RetryAfter)
+	}
+}
+
+func TestRateLimiter_FailLocal_Uses_Local_Reservations(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         3,
+		Cache:            &mockFailedCache{},
+		FailurePolicy:    ratelimiter.FailLocal,
+	})
+
+	if reservation := limiter.Reserve("test", 3); !reservation.OK() || reservation.Delay() > 0 {
+		t.Errorf("Expected reservation to be OK right away, but it wasn't")
+	}
+
+	if reservation := limiter.Reserve("test", 1); !reservation.OK() || reservation.Delay() == 0 {
+		t.Errorf("Expected reservation to be delayed by the local limiter, but it wasn't")
+	}
+}
+
+func TestRateLimiter_AllowCtx_Follows_FailurePolicy_When_Context_Is_Done(t *testing.T) {
+	tests := []struct {
+		name            string
+		failurePolicy   ratelimiter.FailurePolicy
+		expectedAllowed bool
+	}{
+		{name: "fail open", failurePolicy: ratelimiter.FailOpen, expectedAllowed: true},
+		{name: "fail closed", failurePolicy: ratelimiter.FailClosed, expectedAllowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimiter.New(ratelimiter.Options{
+				MaxRatePerSecond: 1,
+				MaxBurst:         3,
+				Cache:            &mockContextCache{GetterSetter: cache.NewInMemory()},
+				FailurePolicy:    tt.failurePolicy,
+			})
+
+			if !limiter.AllowCtx(context.Background(), "test") {
+				t.Errorf("Expected limiter to allow the event with a live context, but it didn't")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if allowed := limiter.AllowCtx(ctx, "test"); allowed != tt.expectedAllowed {
+				t.Errorf("Expected allowed to be %v with a cancelled context, but got %v", tt.expectedAllowed, allowed)
+			}
+
+			if _, err := limiter.DecideCtx(ctx, "test"); !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected the context error, but got %v", err)
+			}
+
+			if remaining := limiter.Remaining("test"); remaining != 2 {
+				t.Errorf("Expected only the event with a live context to be counted, but %d tokens remain", remaining)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Administration_Honours_Context_Cancellation(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         3,
+		Cache:            &mockContextCache{GetterSetter: cache.NewInMemory()},
+		FailurePolicy:    ratelimiter.FailClosed,
+		Penalty:          ratelimiter.Penalty{BanDuration: time.Minute},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := limiter.SetCtx(ctx, "test", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error from SetCtx, but got %v", err)
+	}
+
+	if _, err := limiter.InspectCtx(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error from InspectCtx, but got %v", err)
+	}
+
+	if err := limiter.BanCtx(ctx, "test", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error from BanCtx, but got %v", err)
+	}
+
+	if err := limiter.UnbanCtx(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error from UnbanCtx, but got %v", err)
+	}
+
+	if reservation := limiter.ReserveCtx(ctx, "test", 1); reservation.OK() {
+		t.Errorf("Expected reservation not to be OK with a cancelled context and FailClosed, but it was")
+	}
+
+	// nothing was stored with the cancelled context
+	if remaining := limiter.Remaining("test"); remaining != 3 {
+		t.Errorf("Expected %d remaining tokens, got %d", 3, remaining)
+	}
+}
+
+var errMockWrite = errors.New("mock cache error: write")
+
+// mockFailedWritesCache is a mock implementation of the cache.GetterSetter interface that misses on reads and fails on writes.
+type mockFailedWritesCache struct{}
+
+func (c *mockFailedWritesCache) Get(key string) (int, error) {
+	return 0, cache.ErrCacheMiss
+}
+
+func (c *mockFailedWritesCache) Set(key string, value int) error {
+	return errMockWrite
+}
+
+func (c *mockFailedWritesCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
+	return errMockWrite
+}
+
+// mockContextCache is a mock implementation of the cache.ContextGetterSetter interface that fails all operations once the context is done.
+type mockContextCache struct {
+	cache.GetterSetter
+	ctx context.Context
+}
+
+func (c *mockContextCache) Get(key string) (int, error) {
+	return c.GetContext(c.ctx, key)
+}
+
+func (c *mockContextCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
+	return c.SetWithExpirationContext(c.ctx, key, value, expiration)
+}
+
+func (c *mockContextCache) GetContext(ctx context.Context, key string) (int, error) {
+	if ctx != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return c.GetterSetter.Get(key)
+}
+
+func (c *mockContextCache) SetContext(ctx context.Context, key string, value int) error {
+	return c.SetWithExpirationContext(ctx, key, value, 0)
+}
+
+func (c *mockContextCache) SetWithExpirationContext(ctx context.Context, key string, value int, expiration time.Duration) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return c.GetterSetter.SetWithExpiration(key, value, expiration)
+}
+
+func (c *mockContextCache) WithContext(ctx context.Context) cache.GetterSetter {
+	return &mockContextCache{GetterSetter: c.GetterSetter, ctx: ctx}
+}
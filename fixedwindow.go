@@ -0,0 +1,138 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// incrementWindowCountFor adds delta to the event count of a window for a particular key and returns the new count.
+// The count expires when the window ends.
+func (rl *RateLimiter) incrementWindowCountFor(ctx context.Context, sourceKey string, window int, delta int, expiration time.Duration) (int, error) {
+	return rl.incrementCountFor(ctx, rl.getWindowKeyFor(sourceKey, window), delta, expiration)
+}
+
+// incrementCountFor adds delta to the count stored at key and returns the new count, like incrementCount.
+func (rl *RateLimiter) incrementCountFor(ctx context.Context, key string, delta int, expiration time.Duration) (int, error) {
+	return incrementCount(rl.cacheFor(ctx), key, delta, expiration)
+}
+
+// incrementCount adds delta to the count stored at key in c and returns the new count.
+// Missing counts are incremented from zero and set to expire after the given expiration.
+// If the cache implements [cache.Incrementer], the count is incremented atomically and keeps its first expiration.
+func incrementCount(c cache.GetterSetter, key string, delta int, expiration time.Duration) (int, error) {
+	if incrementer, ok := c.(cache.Incrementer); ok {
+		return incrementer.IncrementWithExpiration(key, delta, expiration)
+	}
+
+	count, err := c.Get(key)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, err
+	}
+
+	count += delta
+	return count, c.SetWithExpiration(key, count, expiration)
+}
+
+// takeFromFixedWindow counts n events for a particular key if there is room for them in the current window.
+// Windows are aligned to the Unix epoch, so windows lasting a minute reset on the minute.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) takeFromFixedWindow(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		// an infinite window never resets
+		return Result{Limit: rl.rate.Events, RetryAfter: time.Duration(math.MaxInt64)}, nil
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+	windowLength := rl.countWindowMilliseconds()
+	window := now / windowLength
+	windowEnd := (window + 1) * windowLength
+	expiration := time.Duration(windowEnd-now) * time.Millisecond
+	limit := rl.countWindowLimit()
+
+	count, err := rl.incrementWindowCountFor(ctx, sourceKey, window, n, expiration)
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed := count <= limit
+	if !allowed {
+		// give the events back, so denied events don't count against the window
+		if count, err = rl.incrementWindowCountFor(ctx, sourceKey, window, -n, expiration); err != nil {
+			// the events are denied either way, and an overcounted window still ends on time
+			count = limit
+		}
+	}
+
+	return rl.fixedWindowResultFor(count, n, now, windowEnd, allowed), nil
+}
+
+// fixedWindowResultFor builds the result of a decision for an event costing n tokens, given the window count after it.
+func (rl *RateLimiter) fixedWindowResultFor(count int, n int, now int, windowEnd int, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: rl.countWindowLimit() - count,
+		Limit:     rl.rate.Events,
+	}
+
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if count > 0 {
+		result.ResetAfter = time.Duration(windowEnd-now) * time.Millisecond
+		result.ResetAt = time.UnixMilli(int64(windowEnd))
+	}
+
+	if result.Remaining < n {
+		result.RetryAfter = time.Duration(windowEnd-now) * time.Millisecond
+	}
+
+	return result
+}
+
+// remainingInFixedWindow returns the number of events that can still be counted for a particular key in the current window.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingInFixedWindow(ctx context.Context, sourceKey string) (int, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		return 0, nil
+	}
+
+	window := int(rl.clock.Now().UnixMilli()) / rl.countWindowMilliseconds()
+
+	count, err := rl.cacheFor(ctx).Get(rl.getWindowKeyFor(sourceKey, window))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, err
+	}
+
+	limit := rl.countWindowLimit()
+	if count > limit {
+		return 0, nil
+	}
+
+	return limit - count, nil
+}
+
+// setFixedWindowTokens stores a count for the current window of a particular key that leaves the given tokens in it.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setFixedWindowTokens(ctx context.Context, sourceKey string, tokens int) error {
+	if rl.maxRatePerMillisecond <= 0 {
+		return nil
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+	windowLength := rl.countWindowMilliseconds()
+	window := now / windowLength
+	expiration := time.Duration((window+1)*windowLength-now) * time.Millisecond
+
+	// windows kept across a slower rate allow fewer events than the burst
+	limit := rl.countWindowLimit()
+	if tokens > limit {
+		tokens = limit
+	}
+
+	return rl.cacheFor(ctx).SetWithExpiration(rl.getWindowKeyFor(sourceKey, window), limit-tokens, expiration)
+}
@@ -0,0 +1,110 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_FixedWindow_Allow(t *testing.T) {
+	sourceKey := "test"
+
+	// 200 milliseconds into a window
+	clock := ratelimitertest.NewClock(time.Date(2024, time.January, 10, 8, 0, 0, 200*int(time.Millisecond), time.UTC))
+
+	// 5 events in each 500 milliseconds window
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.FixedWindow,
+		Clock:            clock,
+	}
+	limiter := ratelimiter.New(options)
+
+	result, _ := limiter.Decide(sourceKey)
+	if !result.Allowed || result.Remaining != 4 {
+		t.Errorf("Expected event to be allowed with 4 remaining events, got %+v", result)
+	}
+
+	// Windows are aligned to the wall clock
+	resetAt := clock.Now().Add(300 * time.Millisecond)
+	if !result.ResetAt.Equal(resetAt) || result.ResetAfter != 300*time.Millisecond {
+		t.Errorf("Expected window to reset at %v, 300ms from now, got %+v", resetAt, result)
+	}
+
+	ratelimitertest.AssertAllowedN(t, limiter, sourceKey, 4)
+
+	clock.Advance(299 * time.Millisecond)
+	result = ratelimitertest.AssertDenied(t, limiter, sourceKey)
+	if !result.ResetAt.Equal(resetAt) || result.RetryAfter != time.Millisecond || result.RetryAfter != result.ResetAfter {
+		t.Errorf("Expected to retry when the window resets at %v, got %+v", resetAt, result)
+	}
+
+	clock.Advance(time.Millisecond)
+	if remaining := limiter.Remaining(sourceKey); remaining != 5 {
+		t.Errorf("Expected %d remaining events, got %d", 5, remaining)
+	}
+}
+
+func TestRateLimiter_FixedWindow_Windows_Last_At_Least_A_Millisecond(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// a full burst takes half a millisecond
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10000,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.FixedWindow,
+		Clock:            clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 5)
+	ratelimitertest.AssertDenied(t, limiter, "test")
+
+	if _, err := limiter.Inspect("test"); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+
+	clock.Advance(time.Millisecond)
+	ratelimitertest.AssertAllowed(t, limiter, "test")
+
+	// a zero burst never allows events
+	limiter = ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		Algorithm:        ratelimiter.FixedWindow,
+		Clock:            clock,
+	})
+
+	if remaining := limiter.Remaining("test"); remaining != 0 {
+		t.Errorf("Expected %d remaining events, got %d", 0, remaining)
+	}
+
+	if limiter.Allow("test") {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if err := limiter.Reset("test"); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+}
+
+func TestRateLimiter_FixedWindow_Works_With_Any_Cache(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         60,
+		Algorithm:        ratelimiter.FixedWindow,
+		Cache:            &mockGetterSetterCache{values: map[string]int{}},
+	}
+	limiter := ratelimiter.New(options)
+
+	for i := 0; i < 10; i++ {
+		_ = limiter.Allow(sourceKey)
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 50 {
+		t.Errorf("Expected %d remaining events, got %d", 50, remaining)
+	}
+}
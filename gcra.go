@@ -0,0 +1,161 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const arrivalKeyPrefix = "rl:tat:"
+
+func (rl *RateLimiter) getArrivalKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(arrivalKeyPrefix, sourceKey)
+}
+
+// emissionInterval returns the time between events at the maximum rate, in microseconds.
+// Timestamps have microsecond precision, so rates above a million events per second are applied as one event per microsecond.
+func (rl *RateLimiter) emissionInterval() int {
+	if interval := int(rl.rate.TimeFor(1).Microseconds()); interval > 0 {
+		return interval
+	}
+
+	return 1
+}
+
+// ceilMilliseconds rounds d up to whole milliseconds, and to at least one millisecond.
+// Caches store expirations in whole milliseconds, so shorter ones would expire right away or never.
+func ceilMilliseconds(d time.Duration) time.Duration {
+	if d <= time.Millisecond {
+		return time.Millisecond
+	}
+
+	return (d + time.Millisecond - 1).Truncate(time.Millisecond)
+}
+
+// advanceTimestamp raises the timestamp, in microseconds, stored at key to at least now and adds delta to it, storing it only if it does not exceed ceiling.
+// It returns the resulting timestamp, and whether it was stored.
+// If the cache implements [cache.Advancer], the timestamp is updated atomically in a single call, otherwise compare-and-swap is used if available.
+func (rl *RateLimiter) advanceTimestamp(ctx context.Context, key string, now, delta, ceiling int) (int, bool, error) {
+	c := rl.cacheFor(ctx)
+
+	expiration := ceilMilliseconds(time.Duration(ceiling-now) * time.Microsecond)
+
+	if advancer, ok := c.(cache.Advancer); ok {
+		return advancer.AdvanceWithExpiration(key, now, delta, ceiling, expiration)
+	}
+
+	for {
+		stored, err := c.Get(key)
+		if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+			return 0, false, err
+		}
+
+		timestamp := stored
+		if timestamp < now {
+			timestamp = now
+		}
+
+		if timestamp+delta > ceiling {
+			return timestamp, false, nil
+		}
+		timestamp += delta
+
+		if cas, ok := c.(cache.CompareAndSwapper); ok {
+			swapped, err := cas.CompareAndSwap([]string{key}, []int{stored}, []int{timestamp}, expiration)
+			if err != nil {
+				return 0, false, err
+			}
+
+			if !swapped {
+				// the timestamp was changed by a concurrent caller, try again with the updated value
+				continue
+			}
+
+			return timestamp, true, nil
+		}
+
+		return timestamp, true, c.SetWithExpiration(key, timestamp, expiration)
+	}
+}
+
+// takeFromArrival advances the theoretical arrival time for a particular key by n emission intervals if it stays within the burst tolerance.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) takeFromArrival(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		// events are never emitted at a zero rate
+		return Result{Limit: rl.rate.Events, RetryAfter: time.Duration(math.MaxInt64)}, nil
+	}
+
+	now := int(rl.clock.Now().UnixMicro())
+	interval := rl.emissionInterval()
+	ceiling := now + rl.maxBurst*interval
+
+	arrival, allowed, err := rl.advanceTimestamp(ctx, rl.getArrivalKeyFor(sourceKey), now, n*interval, ceiling)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:    allowed,
+		Remaining:  (ceiling - arrival) / interval,
+		Limit:      rl.rate.Events,
+		ResetAfter: time.Duration(arrival-now) * time.Microsecond,
+	}
+
+	if result.Remaining < n {
+		result.RetryAfter = time.Duration(arrival+n*interval-ceiling) * time.Microsecond
+	}
+
+	if result.Remaining < 0 {
+		// the arrival time is beyond the burst tolerance after it was lowered
+		result.Remaining = 0
+	}
+
+	return result, nil
+}
+
+// remainingInArrival returns the number of events that fit in the burst tolerance for a particular key.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingInArrival(ctx context.Context, sourceKey string) (int, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		return 0, nil
+	}
+
+	arrival, err := rl.cacheFor(ctx).Get(rl.getArrivalKeyFor(sourceKey))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, err
+	}
+
+	now := int(rl.clock.Now().UnixMicro())
+	if arrival < now {
+		arrival = now
+	}
+
+	interval := rl.emissionInterval()
+
+	remaining := (now + rl.maxBurst*interval - arrival) / interval
+	if remaining < 0 {
+		return 0, nil
+	}
+
+	return remaining, nil
+}
+
+// setArrivalTokens stores a theoretical arrival time for a particular key that leaves the given tokens within the burst tolerance.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setArrivalTokens(ctx context.Context, sourceKey string, tokens int) error {
+	if rl.maxRatePerMillisecond <= 0 {
+		return nil
+	}
+
+	now := int(rl.clock.Now().UnixMicro())
+	arrival := now + (rl.maxBurst-tokens)*rl.emissionInterval()
+
+	// an arrival time in the past is the same as none, so it only needs to last until then
+	expiration := time.Duration(arrival-now)*time.Microsecond + time.Millisecond
+
+	return rl.cacheFor(ctx).SetWithExpiration(rl.getArrivalKeyFor(sourceKey), arrival, expiration)
+}
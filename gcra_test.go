@@ -0,0 +1,140 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_GCRA_Allow(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.GCRA,
+		Clock:            clock,
+	}
+	limiter := ratelimiter.New(options)
+
+	// Allow 5 events
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	// Try to allow 1 more event, which should be rate-limited
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	// Allow 2 more events after waiting for 200 milliseconds
+	clock.Advance(200 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+}
+
+func TestRateLimiter_GCRA_Decide(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         2,
+		Algorithm:        ratelimiter.GCRA,
+	}
+	limiter := ratelimiter.New(options)
+
+	result, _ := limiter.Decide(sourceKey)
+	if !result.Allowed || result.Remaining != 1 || result.RetryAfter != 0 {
+		t.Errorf("Expected event to be allowed with 1 remaining token, got %+v", result)
+	}
+
+	if result.ResetAfter != 100*time.Millisecond {
+		t.Errorf("Expected bucket to be full after 100ms, got %v", result.ResetAfter)
+	}
+
+	_, _ = limiter.Decide(sourceKey)
+
+	result, _ = limiter.Decide(sourceKey)
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected limiter to rate-limit event, got %+v", result)
+	}
+
+	if result.RetryAfter <= 90*time.Millisecond || result.RetryAfter > 100*time.Millisecond {
+		t.Errorf("Expected next token within 100ms, got %v", result.RetryAfter)
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining tokens, got %d", 0, remaining)
+	}
+}
+
+func TestRateLimiter_GCRA_Works_With_Any_Cache(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.GCRA,
+		Cache:            &mockGetterSetterCache{values: map[string]int{}},
+	}
+	limiter := ratelimiter.New(options)
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+}
+
+func TestRateLimiter_GCRA_Keeps_State_At_High_Rates(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// a full burst takes half a millisecond, shorter than the cache expiration resolution
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:      ratelimiter.Per(10000, time.Second),
+		MaxBurst:  5,
+		Algorithm: ratelimiter.GCRA,
+		Clock:     clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, sourceKey, 5)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+
+	clock.Advance(100 * time.Microsecond)
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+
+	// the emission interval is shorter than a microsecond
+	limiter = ratelimiter.New(ratelimiter.Options{
+		Rate:      ratelimiter.Per(2_000_000, time.Second),
+		MaxBurst:  3,
+		Algorithm: ratelimiter.GCRA,
+		Clock:     clock,
+	})
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 3 {
+		t.Errorf("Expected %d remaining events, got %d", 3, remaining)
+	}
+
+	ratelimitertest.AssertAllowedN(t, limiter, sourceKey, 3)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+}
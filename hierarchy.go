@@ -0,0 +1,208 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// Level represents the limits applied to each key at one level of a hierarchy, such as users, organisations or the whole service.
+type Level struct {
+	Rate     Rate // The maximum rate of events allowed for each key at this level.
+	MaxBurst int  // The maximum number of events that can be bursted for each key at this level.
+}
+
+// ParentFunc returns the key of the parent of a particular key in a hierarchy, eg. the organisation of a user, and whether it has one.
+type ParentFunc func(sourceKey string) (string, bool)
+
+// HierarchyOptions represents the options for configuring a hierarchical rate limiter.
+type HierarchyOptions struct {
+	Levels        []Level            // The limits of each level, starting with the leaves, eg. users, then organisations, then the whole service. Without levels, events are never limited.
+	Parent        ParentFunc         // Returns the key of the parent of a key at the next level. Keys without a parent are only limited up to their own level.
+	Cache         cache.GetterSetter // The cache to store the buckets of all levels. If not provided, an in-memory cache will be used.
+	CacheTTL      time.Duration      // The time-to-live for the buckets in the cache. They are kept at least until they would be full again.
+	FailurePolicy FailurePolicy      // How events are decided when cache operations fail. Default is FailOpen.
+	Clock         Clock              // The clock to read the current time from. Default is a monotonic clock.
+	Namespace     string             // Prefixes the cache keys of the limiter, so limiters with different limits can share a cache.
+	KeyBuilder    KeyBuilder         // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is DefaultKeyBuilder.
+}
+
+// HierarchicalLimiter represents a tree of token buckets, where each event consumes from the bucket of its key and from the buckets of all its ancestors, eg. a user, its organisation and the whole service.
+// Tokens are consumed from all levels or from none of them, atomically when the cache implements [cache.CompareAndSwapper].
+type HierarchicalLimiter struct {
+	levels        []*RateLimiter       // The token bucket limiter of each level.
+	parent        ParentFunc           // Returns the key of the parent of a key.
+	failurePolicy FailurePolicy        // How events are decided when cache operations fail.
+	fallback      *HierarchicalLimiter // The local limiter used while the cache fails, when the failure policy is FailLocal.
+}
+
+// getLevelKeyFor returns the source key under which the state of a key at a level is stored, so keys at different levels never share a bucket.
+func (hl *HierarchicalLimiter) getLevelKeyFor(sourceKey string, level int) string {
+	return sourceKey + ":level:" + strconv.Itoa(level)
+}
+
+// pathFor returns the token bucket limiters and the source keys of a particular key and its ancestors, up to the last level or to the first key without a parent.
+func (hl *HierarchicalLimiter) pathFor(sourceKey string) ([]*RateLimiter, []string) {
+	keys := []string{hl.getLevelKeyFor(sourceKey, 0)}
+
+	for level := 1; level < len(hl.levels) && hl.parent != nil; level++ {
+		parent, ok := hl.parent(sourceKey)
+		if !ok {
+			break
+		}
+
+		sourceKey = parent
+		keys = append(keys, hl.getLevelKeyFor(sourceKey, level))
+	}
+
+	return hl.levels[:len(keys)], keys
+}
+
+// Allow checks if an event is allowed for a particular key and all its ancestors, consuming a token from each of their buckets if so.
+// If cache operations fail, the decision follows the failure policy.
+func (hl *HierarchicalLimiter) Allow(sourceKey string) bool {
+	result, _ := hl.DecideNCtx(context.Background(), sourceKey, 1)
+	return result.Allowed
+}
+
+// Decide works like Allow, but returns the result of the level that bound the decision, along with the error of failed cache operations.
+func (hl *HierarchicalLimiter) Decide(sourceKey string) (Result, error) {
+	return hl.DecideNCtx(context.Background(), sourceKey, 1)
+}
+
+// DecideN checks if there are at least n tokens available for a particular key and all its ancestors, consuming them from every level if so, or from none of them.
+// The result is the one of the level that bound the decision, which is the one delaying events for the longest time, or the one with fewer remaining events if none delays them.
+// If n is greater than the maximum burst of any level, the event can never be allowed and ErrExceedsBurst is returned.
+// If cache operations fail, the result follows the failure policy and the cache error is returned.
+func (hl *HierarchicalLimiter) DecideN(sourceKey string, n int) (Result, error) {
+	return hl.DecideNCtx(context.Background(), sourceKey, n)
+}
+
+// DecideNCtx works like DecideN, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (hl *HierarchicalLimiter) DecideNCtx(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if len(hl.levels) == 0 {
+		// no level limits the event
+		return Result{Allowed: true, Remaining: math.MaxInt}, nil
+	}
+
+	limiters, keys := hl.pathFor(sourceKey)
+
+	for level, limiter := range limiters {
+		if n > limiter.maxBurst {
+			return Result{Limit: limiter.rate.Events, RetryAfter: time.Duration(math.MaxInt64), Level: level}, ErrExceedsBurst
+		}
+	}
+
+	if n <= 0 {
+		n = 0
+	}
+
+	result, level, err := takeFromBuckets(ctx, limiters, keys, n)
+	if err != nil {
+		return hl.failedTake(ctx, sourceKey, n), cacheError(err)
+	}
+
+	result.Level = level
+	result.ResetAt = limiters[level].clock.Now().Add(result.ResetAfter)
+
+	return result, nil
+}
+
+// Remaining returns the number of tokens available for a particular key and all its ancestors, which is the fewest available at any of their levels.
+// If cache operations fail, the number follows the failure policy.
+func (hl *HierarchicalLimiter) Remaining(sourceKey string) int {
+	if len(hl.levels) == 0 {
+		return math.MaxInt
+	}
+
+	limiters, keys := hl.pathFor(sourceKey)
+	ctx := context.Background()
+
+	remaining := -1
+	for level, limiter := range limiters {
+		tokens, err := limiter.remainingInBucket(ctx, keys[level])
+		if err != nil {
+			return hl.failedRemaining(sourceKey)
+		}
+
+		if remaining < 0 || tokens < remaining {
+			remaining = tokens
+		}
+	}
+
+	return remaining
+}
+
+// failedTake decides on n tokens for a particular key according to the failure policy, after cache operations failed.
+// The first level is reported, as the binding one is unknown.
+func (hl *HierarchicalLimiter) failedTake(ctx context.Context, sourceKey string, n int) Result {
+	leaf := hl.levels[0]
+
+	switch hl.failurePolicy {
+	case FailClosed:
+		return Result{Limit: leaf.rate.Events, RetryAfter: leaf.rate.TimeFor(1)}
+	case FailLocal:
+		result, _ := hl.fallback.DecideNCtx(ctx, sourceKey, n)
+		return result
+	default:
+		return Result{Allowed: true, Remaining: leaf.maxBurst, Limit: leaf.rate.Events}
+	}
+}
+
+// failedRemaining returns the number of tokens available for a particular key according to the failure policy, after cache operations failed.
+func (hl *HierarchicalLimiter) failedRemaining(sourceKey string) int {
+	switch hl.failurePolicy {
+	case FailClosed:
+		return 0
+	case FailLocal:
+		return hl.fallback.Remaining(sourceKey)
+	default:
+		return hl.levels[0].maxBurst
+	}
+}
+
+// NewHierarchy creates a new ready to use HierarchicalLimiter with the specified options.
+// A hierarchy without levels allows every event.
+func NewHierarchy(options HierarchyOptions) *HierarchicalLimiter {
+	if options.Clock == nil {
+		options.Clock = cache.NewMonotonicClock()
+	}
+
+	if options.Cache == nil {
+		options.Cache = cache.NewInMemory(options.Clock)
+	}
+
+	if options.CacheTTL == 0 {
+		options.CacheTTL = 10 * time.Second
+	}
+
+	bandwidths := make([]Bandwidth, len(options.Levels))
+	for i, level := range options.Levels {
+		bandwidths[i] = Bandwidth(level)
+	}
+
+	var fallback *HierarchicalLimiter
+	if options.FailurePolicy == FailLocal {
+		fallbackOptions := options
+		fallbackOptions.Cache = cache.NewInMemory(options.Clock)
+		fallbackOptions.FailurePolicy = FailOpen
+
+		fallback = NewHierarchy(fallbackOptions)
+	}
+
+	return &HierarchicalLimiter{
+		levels: newBands(bandwidths, Options{
+			Cache:      options.Cache,
+			CacheTTL:   options.CacheTTL,
+			Clock:      options.Clock,
+			Namespace:  options.Namespace,
+			KeyBuilder: options.KeyBuilder,
+		}),
+		parent:        options.Parent,
+		failurePolicy: options.FailurePolicy,
+		fallback:      fallback,
+	}
+}
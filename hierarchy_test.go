@@ -0,0 +1,203 @@
+package ratelimiter_test
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+// orgOf returns the organisation of user keys in the form "org/user", and the whole service for organisations.
+func orgOf(sourceKey string) (string, bool) {
+	if org, _, ok := strings.Cut(sourceKey, "/"); ok {
+		return org, true
+	}
+
+	return "global", true
+}
+
+func TestHierarchicalLimiter_Consumes_From_All_Levels_Or_None(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.NewHierarchy(ratelimiter.HierarchyOptions{
+		Levels: []ratelimiter.Level{
+			{Rate: ratelimiter.Per(1, time.Second), MaxBurst: 2},
+			{Rate: ratelimiter.Per(1, time.Second), MaxBurst: 3},
+			{Rate: ratelimiter.Per(1, time.Second), MaxBurst: 4},
+		},
+		Parent: orgOf,
+		Clock:  clock,
+	})
+
+	steps := []struct {
+		sourceKey     string
+		expected      bool
+		expectedLevel int
+	}{
+		{sourceKey: "acme/alice", expected: true},
+		{sourceKey: "acme/alice", expected: true},
+		// alice is out of tokens, so acme and the service are not charged
+		{sourceKey: "acme/alice", expected: false, expectedLevel: 0},
+		{sourceKey: "acme/bob", expected: true},
+		// acme is out of tokens, so bob and the service are not charged
+		{sourceKey: "acme/bob", expected: false, expectedLevel: 1},
+		{sourceKey: "initech/carol", expected: true},
+		// the service is out of tokens, so carol and initech are not charged
+		{sourceKey: "initech/carol", expected: false, expectedLevel: 2},
+	}
+
+	for i, step := range steps {
+		result, err := limiter.Decide(step.sourceKey)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		if result.Allowed != step.expected {
+			t.Fatalf("Expected step %d for %s to be allowed %v, but got %v", i, step.sourceKey, step.expected, result.Allowed)
+		}
+
+		if !result.Allowed && result.Level != step.expectedLevel {
+			t.Errorf("Expected step %d to be bound by level %d, but got %d", i, step.expectedLevel, result.Level)
+		}
+	}
+
+	// a second refills a token at every level, and denied events took none
+	clock.Advance(time.Second)
+
+	if remaining := limiter.Remaining("initech/carol"); remaining != 1 {
+		t.Errorf("Expected 1 token remaining for carol, but got %d", remaining)
+	}
+
+	if !limiter.Allow("initech/carol") {
+		t.Errorf("Expected carol to be allowed after the refill, but she wasn't")
+	}
+}
+
+func TestHierarchicalLimiter_Keys_Without_Parent_Stop_At_Their_Level(t *testing.T) {
+	limiter := ratelimiter.NewHierarchy(ratelimiter.HierarchyOptions{
+		Levels: []ratelimiter.Level{
+			{Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 5},
+			{Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 1},
+		},
+		Parent: func(sourceKey string) (string, bool) {
+			return "shared", sourceKey != "internal"
+		},
+		Clock: ratelimitertest.NewClock(time.Time{}),
+	})
+
+	ratelimitertest.AssertAllowed(t, limiter, "public")
+	ratelimitertest.AssertDenied(t, limiter, "public")
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow("internal") {
+			t.Fatalf("Expected event %d for a key without parent to be allowed, but it wasn't", i+1)
+		}
+	}
+
+	if _, err := limiter.DecideN("internal", 2); err != nil {
+		t.Errorf("Expected no error for an event within the leaf burst, but got %v", err)
+	}
+
+	if _, err := limiter.DecideN("public", 2); err != ratelimiter.ErrExceedsBurst {
+		t.Errorf("Expected error %v, but got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+}
+
+func TestHierarchicalLimiter_Without_Levels_Allows_Every_Event(t *testing.T) {
+	limiter := ratelimiter.NewHierarchy(ratelimiter.HierarchyOptions{
+		Parent: func(sourceKey string) (string, bool) {
+			return "shared", true
+		},
+		FailurePolicy: ratelimiter.FailLocal,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 10)
+
+	if _, err := limiter.DecideN("test", 100); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+
+	if remaining := limiter.Remaining("test"); remaining != math.MaxInt {
+		t.Errorf("Expected unlimited remaining events, but got %d", remaining)
+	}
+}
+
+func TestHierarchicalLimiter_Does_Not_Overspend_Under_Concurrency(t *testing.T) {
+	limiter := ratelimiter.NewHierarchy(ratelimiter.HierarchyOptions{
+		Levels: []ratelimiter.Level{
+			{Rate: ratelimiter.Per(50, time.Minute), MaxBurst: 50},
+			{Rate: ratelimiter.Per(20, time.Minute), MaxBurst: 20},
+		},
+		Parent: orgOf,
+	})
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sourceKey := "acme/alice"
+			if i%2 == 0 {
+				sourceKey = "acme/bob"
+			}
+
+			if limiter.Allow(sourceKey) {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if allowed != 20 {
+		t.Errorf("Expected limiter to allow 20 events, but it allowed %d", allowed)
+	}
+}
+
+func TestHierarchicalLimiter_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		failurePolicy   ratelimiter.FailurePolicy
+		expectedAllowed int
+	}{
+		{name: "fail open", failurePolicy: ratelimiter.FailOpen, expectedAllowed: 10},
+		{name: "fail closed", failurePolicy: ratelimiter.FailClosed, expectedAllowed: 0},
+		// the local limiter still applies the limits of the organisation
+		{name: "fail local", failurePolicy: ratelimiter.FailLocal, expectedAllowed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimiter.NewHierarchy(ratelimiter.HierarchyOptions{
+				Levels: []ratelimiter.Level{
+					{Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 5},
+					{Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 3},
+				},
+				Parent:        orgOf,
+				Cache:         &mockFailedCache{},
+				FailurePolicy: tt.failurePolicy,
+			})
+
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				result, err := limiter.Decide("acme/alice")
+				if err == nil {
+					t.Errorf("Expected the cache error, but got nil")
+				}
+
+				if result.Allowed {
+					allowed++
+				}
+			}
+
+			if allowed != tt.expectedAllowed {
+				t.Errorf("Expected limiter to allow %d events, but it allowed %d", tt.expectedAllowed, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package ratelimiter
+
+// KeyBuilder builds the cache key under which a kind of state is stored for a source key, from the namespace of the limiter,
+// the prefix of the kind of state, eg. "rl:bucket:", and the source key, eg. to hash long source keys or to add Redis Cluster hash tags.
+// Keys built for different inputs must be different, or limiters would share their state.
+type KeyBuilder func(namespace, prefix, sourceKey string) string
+
+// DefaultKeyBuilder builds cache keys such as "rl:bucket:user-1", or "checkout:rl:bucket:user-1" in the "checkout" namespace.
+func DefaultKeyBuilder(namespace, prefix, sourceKey string) string {
+	if namespace == "" {
+		return prefix + sourceKey
+	}
+
+	return namespace + ":" + prefix + sourceKey
+}
+
+// keySpace builds the cache keys of a limiter within its namespace.
+type keySpace struct {
+	namespace string     // The namespace of the limiter, isolating its keys from the ones of other limiters sharing the cache.
+	builder   KeyBuilder // Builds the cache keys.
+}
+
+// newKeySpace creates a key space for the namespace, using the default key builder if builder is nil.
+func newKeySpace(namespace string, builder KeyBuilder) keySpace {
+	if builder == nil {
+		builder = DefaultKeyBuilder
+	}
+
+	return keySpace{namespace: namespace, builder: builder}
+}
+
+// keyFor returns the cache key under which the kind of state with the given prefix is stored for a particular key.
+func (ks keySpace) keyFor(prefix, sourceKey string) string {
+	return ks.builder(ks.namespace, prefix, sourceKey)
+}
@@ -0,0 +1,147 @@
+package ratelimiter_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_Namespaces_Isolate_Limiters_Sharing_A_Cache(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ratelimiter.Options
+	}{
+		{name: "token bucket", options: ratelimiter.Options{Algorithm: ratelimiter.TokenBucket}},
+		{name: "sliding window log", options: ratelimiter.Options{Algorithm: ratelimiter.SlidingWindowLog}},
+		{name: "sliding window counter", options: ratelimiter.Options{Algorithm: ratelimiter.SlidingWindowCounter}},
+		{name: "fixed window", options: ratelimiter.Options{Algorithm: ratelimiter.FixedWindow}},
+		{name: "gcra", options: ratelimiter.Options{Algorithm: ratelimiter.GCRA}},
+		{name: "bandwidths", options: ratelimiter.Options{Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(2, time.Minute), MaxBurst: 2},
+			{Rate: ratelimiter.Per(10, time.Hour), MaxBurst: 10},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratelimitertest.NewClock(time.Time{})
+
+			options := tt.options
+			options.Rate = ratelimiter.Per(2, time.Minute)
+			options.MaxBurst = 2
+			options.Cache = cache.NewInMemory(clock)
+			options.Clock = clock
+
+			options.Namespace = "checkout"
+			checkout := ratelimiter.New(options)
+			checkoutReplica := ratelimiter.New(options)
+
+			options.Namespace = "search"
+			search := ratelimiter.New(options)
+
+			ratelimitertest.AssertAllowedN(t, checkout, "user-1", 2)
+			ratelimitertest.AssertDenied(t, checkoutReplica, "user-1")
+
+			// the same key in another namespace has its own state
+			ratelimitertest.AssertAllowedN(t, search, "user-1", 2)
+			ratelimitertest.AssertDenied(t, search, "user-1")
+		})
+	}
+}
+
+func TestRateLimiter_Namespaces_Isolate_Penalties(t *testing.T) {
+	sharedCache := cache.NewInMemory()
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Cache:            sharedCache,
+		Penalty:          ratelimiter.Penalty{BanDuration: time.Hour},
+		Namespace:        "login",
+	}
+	login := ratelimiter.New(options)
+
+	options.Namespace = "api"
+	api := ratelimiter.New(options)
+
+	if err := login.Ban("user-1", time.Hour); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if result := ratelimitertest.AssertAllowed(t, api, "user-1"); result.Banned {
+		t.Errorf("Expected the ban not to apply in another namespace, but it did")
+	}
+}
+
+func TestRateLimiter_KeyBuilder_Builds_The_Cache_Keys(t *testing.T) {
+	var built []string
+	hashed := func(namespace, prefix, sourceKey string) string {
+		sum := sha256.Sum256([]byte(sourceKey))
+		key := ratelimiter.DefaultKeyBuilder(namespace, prefix, hex.EncodeToString(sum[:8]))
+		built = append(built, key)
+		return key
+	}
+
+	sharedCache := cache.NewInMemory()
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Cache:            sharedCache,
+		Namespace:        "api",
+		KeyBuilder:       hashed,
+	}
+
+	limiter := ratelimiter.New(options)
+	ratelimitertest.AssertAllowed(t, limiter, strings.Repeat("long-key", 100))
+
+	if len(built) == 0 {
+		t.Fatalf("Expected the key builder to be used, but it wasn't")
+	}
+
+	for _, key := range built {
+		if !strings.HasPrefix(key, "api:rl:") || len(key) > 40 {
+			t.Errorf("Expected a short key in the api namespace, but got %q", key)
+		}
+	}
+
+	// limiters building other keys do not share the state
+	options.KeyBuilder = nil
+	ratelimitertest.AssertAllowed(t, ratelimiter.New(options), strings.Repeat("long-key", 100))
+}
+
+func TestDefaultKeyBuilder(t *testing.T) {
+	if key := ratelimiter.DefaultKeyBuilder("", "rl:bucket:", "user-1"); key != "rl:bucket:user-1" {
+		t.Errorf("Expected key rl:bucket:user-1 without namespace, but got %q", key)
+	}
+
+	if key := ratelimiter.DefaultKeyBuilder("checkout", "rl:bucket:", "user-1"); key != "checkout:rl:bucket:user-1" {
+		t.Errorf("Expected key checkout:rl:bucket:user-1, but got %q", key)
+	}
+}
+
+func TestQuota_And_Concurrency_Namespaces_Isolate_Their_Keys(t *testing.T) {
+	sharedCache := cache.NewInMemory()
+
+	quotaA := ratelimiter.NewQuota(ratelimiter.QuotaOptions{Limit: 1, Cache: sharedCache, Namespace: "a"})
+	quotaB := ratelimiter.NewQuota(ratelimiter.QuotaOptions{Limit: 1, Cache: sharedCache, Namespace: "b"})
+
+	ratelimitertest.AssertAllowed(t, quotaA, "customer")
+	ratelimitertest.AssertAllowed(t, quotaB, "customer")
+
+	concurrencyA := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{MaxConcurrent: 1, Cache: sharedCache, Namespace: "a"})
+	concurrencyB := ratelimiter.NewConcurrency(ratelimiter.ConcurrencyOptions{MaxConcurrent: 1, Cache: sharedCache, Namespace: "b"})
+
+	if _, err := concurrencyA.TryAcquire("customer"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if _, err := concurrencyB.TryAcquire("customer"); err != nil {
+		t.Errorf("Expected the lease in another namespace to be acquired, but got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const (
+	violationsKeyPrefix = "rl:violations:"
+	banKeyPrefix        = "rl:ban:"
+	bansKeyPrefix       = "rl:bans:"
+)
+
+// Penalty represents the escalation applied to keys that keep exceeding the limits, eg. credential-stuffing bots retrying as soon as they are allowed.
+// Keys denied more than MaxViolations times within Window are banned, so all their events are denied until the ban ends.
+// Only events denied by Allow and Decide count as violations, as Wait honours the time to retry, and reservations are not OK while a key is banned.
+// Each ban of the same key lasts twice as long as the previous one, up to MaxBanDuration. Keys going as long as their last ban without being banned again start over from BanDuration.
+type Penalty struct {
+	MaxViolations  int           // The number of denied events tolerated within Window before the key is banned.
+	Window         time.Duration // The window in which denied events are counted. Default is one minute.
+	BanDuration    time.Duration // The duration of the first ban of a key. Zero disables the penalty.
+	MaxBanDuration time.Duration // The duration bans stop growing at. Default is 24 hours.
+}
+
+func (rl *RateLimiter) getViolationsKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(violationsKeyPrefix, sourceKey)
+}
+
+func (rl *RateLimiter) getBanKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(banKeyPrefix, sourceKey)
+}
+
+func (rl *RateLimiter) getBansKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(bansKeyPrefix, sourceKey)
+}
+
+// normalizePenalty applies the defaults of the options of a penalty.
+func normalizePenalty(penalty Penalty) Penalty {
+	if penalty.BanDuration <= 0 {
+		return Penalty{}
+	}
+
+	if penalty.Window <= 0 {
+		penalty.Window = time.Minute
+	}
+
+	if penalty.MaxBanDuration <= 0 {
+		penalty.MaxBanDuration = 24 * time.Hour
+	}
+
+	if penalty.MaxBanDuration < penalty.BanDuration {
+		penalty.MaxBanDuration = penalty.BanDuration
+	}
+
+	return penalty
+}
+
+// Ban blocks all events for a particular key for the given duration, replacing any ban in place.
+// Bans are stored in the cache, so they are enforced by all limiters sharing it that are configured with a Penalty.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) Ban(sourceKey string, duration time.Duration) error {
+	return rl.BanCtx(context.Background(), sourceKey, duration)
+}
+
+// BanCtx works like Ban, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) BanCtx(ctx context.Context, sourceKey string, duration time.Duration) error {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).BanCtx(ctx, sourceKey, duration)
+	}
+
+	bannedUntil := int(rl.clock.Now().Add(duration).UnixMilli())
+
+	expiration := duration
+	if expiration <= 0 {
+		// a ban ending right away is the same as none, and must not be kept forever
+		expiration = rl.cacheTTL
+	}
+
+	if err := rl.cacheFor(ctx).SetWithExpiration(rl.getBanKeyFor(sourceKey), bannedUntil, expiration); err != nil {
+		return cacheError(err)
+	}
+
+	return nil
+}
+
+// Unban lifts the ban of a particular key and forgets its violations, so its next ban lasts BanDuration again.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) Unban(sourceKey string) error {
+	return rl.UnbanCtx(context.Background(), sourceKey)
+}
+
+// UnbanCtx works like Unban, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) UnbanCtx(ctx context.Context, sourceKey string) error {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).UnbanCtx(ctx, sourceKey)
+	}
+
+	keys := rl.penaltyKeysFor(sourceKey)
+	c := rl.cacheFor(ctx)
+
+	if deleter, ok := c.(cache.Deleter); ok {
+		if err := deleter.Delete(keys...); err != nil {
+			return cacheError(err)
+		}
+		return nil
+	}
+
+	// zero values are the same as missing ones, so they only need to last until they would have expired
+	for _, key := range keys {
+		if err := c.SetWithExpiration(key, 0, rl.cacheTTL); err != nil {
+			return cacheError(err)
+		}
+	}
+
+	return nil
+}
+
+// penaltyKeysFor returns the cache keys holding the ban and violations of a particular key.
+func (rl *RateLimiter) penaltyKeysFor(sourceKey string) []string {
+	return []string{rl.getBanKeyFor(sourceKey), rl.getViolationsKeyFor(sourceKey), rl.getBansKeyFor(sourceKey)}
+}
+
+// bannedUntil returns the Unix time in milliseconds when the ban of a particular key ends, or zero if it is not banned.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) bannedUntil(ctx context.Context, sourceKey string) (int, error) {
+	bannedUntil, err := rl.cacheFor(ctx).Get(rl.getBanKeyFor(sourceKey))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, err
+	}
+
+	if bannedUntil <= int(rl.clock.Now().UnixMilli()) {
+		return 0, nil
+	}
+
+	return bannedUntil, nil
+}
+
+// banResultFor returns the result denying an event for a particular key if it is banned, and whether it is.
+// Keys are never banned if the limiter has no penalty.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) banResultFor(ctx context.Context, sourceKey string) (Result, bool, error) {
+	if rl.penalty.BanDuration <= 0 {
+		return Result{}, false, nil
+	}
+
+	bannedUntil, err := rl.bannedUntil(ctx, sourceKey)
+	if err != nil || bannedUntil == 0 {
+		return Result{}, false, err
+	}
+
+	result := Result{
+		Limit:      rl.rate.Events,
+		RetryAfter: time.Duration(bannedUntil-int(rl.clock.Now().UnixMilli())) * time.Millisecond,
+		Banned:     true,
+	}
+
+	return result, true, nil
+}
+
+// penalize counts a denied event against a particular key, and bans it if it exceeded the violations tolerated by the penalty.
+// The event is denied either way, so failed cache operations only leave the violation uncounted.
+func (rl *RateLimiter) penalize(ctx context.Context, sourceKey string, result Result) Result {
+	if rl.penalty.BanDuration <= 0 {
+		return result
+	}
+
+	violations, err := rl.incrementCountFor(ctx, rl.getViolationsKeyFor(sourceKey), 1, rl.penalty.Window)
+	if err != nil || violations <= rl.penalty.MaxViolations {
+		return result
+	}
+
+	duration, err := rl.escalate(ctx, sourceKey)
+	if err != nil {
+		return result
+	}
+
+	result.Banned = true
+	result.RetryAfter = duration
+
+	return result
+}
+
+// escalate bans a particular key for twice as long as its previous ban, if it was banned recently, and forgets its violations.
+// It returns the duration of the ban, or an error if cache operations fail.
+func (rl *RateLimiter) escalate(ctx context.Context, sourceKey string) (time.Duration, error) {
+	c := rl.cacheFor(ctx)
+
+	bans, err := c.Get(rl.getBansKeyFor(sourceKey))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, err
+	}
+
+	duration := rl.penalty.BanDuration
+	for i := 0; i < bans && duration < rl.penalty.MaxBanDuration; i++ {
+		duration *= 2
+	}
+
+	if duration > rl.penalty.MaxBanDuration {
+		duration = rl.penalty.MaxBanDuration
+	}
+
+	bannedUntil := int(rl.clock.Now().Add(duration).UnixMilli())
+	if err := c.SetWithExpiration(rl.getBanKeyFor(sourceKey), bannedUntil, duration); err != nil {
+		return 0, err
+	}
+
+	// the ban count is kept for as long again after the ban ends, so keys banned again soon after get longer bans
+	if err := c.SetWithExpiration(rl.getBansKeyFor(sourceKey), bans+1, 2*duration); err != nil {
+		return 0, err
+	}
+
+	return duration, c.SetWithExpiration(rl.getViolationsKeyFor(sourceKey), 0, rl.penalty.Window)
+}
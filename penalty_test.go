@@ -0,0 +1,155 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_Penalty_Bans_Keys_With_Growing_Bans(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Clock:            clock,
+		Penalty: ratelimiter.Penalty{
+			MaxViolations:  2,
+			Window:         time.Minute,
+			BanDuration:    time.Minute,
+			MaxBanDuration: 3 * time.Minute,
+		},
+	})
+
+	expectedBans := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}
+
+	for _, expectedBan := range expectedBans {
+		ratelimitertest.AssertAllowed(t, limiter, "test")
+
+		// violations up to the tolerated ones are only rate limited
+		for i := 0; i < 2; i++ {
+			if result := ratelimitertest.AssertDenied(t, limiter, "test"); result.Banned {
+				t.Fatalf("Expected key not to be banned after %d violations, but it was", i+1)
+			}
+		}
+
+		result := ratelimitertest.AssertDenied(t, limiter, "test")
+		if !result.Banned || result.RetryAfter != expectedBan {
+			t.Fatalf("Expected key to be banned for %v, but got banned %v for %v", expectedBan, result.Banned, result.RetryAfter)
+		}
+
+		// the bucket refills during the ban, but events are still denied
+		clock.Advance(expectedBan - time.Second)
+		result = ratelimitertest.AssertDenied(t, limiter, "test")
+		if !result.Banned || result.RetryAfter != time.Second {
+			t.Errorf("Expected key to stay banned for 1s, but got banned %v for %v", result.Banned, result.RetryAfter)
+		}
+
+		clock.Advance(time.Second)
+	}
+}
+
+func TestRateLimiter_Penalty_Forgets_Bans_After_Good_Behaviour(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Clock:            clock,
+		Penalty:          ratelimiter.Penalty{BanDuration: time.Minute},
+	})
+
+	ratelimitertest.AssertAllowed(t, limiter, "test")
+	if result := ratelimitertest.AssertDenied(t, limiter, "test"); !result.Banned {
+		t.Fatalf("Expected key to be banned on the first violation, but it wasn't")
+	}
+
+	// the ban ends after a minute and its count is forgotten a minute later
+	clock.Advance(2 * time.Minute)
+
+	ratelimitertest.AssertAllowed(t, limiter, "test")
+	if result := ratelimitertest.AssertDenied(t, limiter, "test"); result.RetryAfter != time.Minute {
+		t.Errorf("Expected the ban to last 1m again, but it lasted %v", result.RetryAfter)
+	}
+}
+
+func TestRateLimiter_Ban_And_Unban(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         5,
+		Clock:            clock,
+		Penalty:          ratelimiter.Penalty{MaxViolations: 10, BanDuration: time.Minute},
+	})
+
+	if err := limiter.Ban("test", time.Hour); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	result := ratelimitertest.AssertDenied(t, limiter, "test")
+	if !result.Banned || result.RetryAfter != time.Hour {
+		t.Errorf("Expected key to be banned for 1h, but got banned %v for %v", result.Banned, result.RetryAfter)
+	}
+
+	if reservation := limiter.Reserve("test", 1); reservation.OK() {
+		t.Errorf("Expected reservation not to be OK while banned, but it was")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := limiter.Wait(ctx, "test"); err != ratelimiter.ErrWaitExceedsDeadline {
+		t.Errorf("Expected error %v, but got %v", ratelimiter.ErrWaitExceedsDeadline, err)
+	}
+
+	state, err := limiter.Inspect("test")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if expected := clock.Now().Add(time.Hour); !state.BannedUntil.Equal(expected) {
+		t.Errorf("Expected key to be banned until %v, but got %v", expected, state.BannedUntil)
+	}
+
+	if err := limiter.Unban("test"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 5)
+}
+
+func TestRateLimiter_Bans_Are_Shared_Through_The_Cache(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+	sharedCache := cache.NewInMemory(clock)
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Cache:            sharedCache,
+		Clock:            clock,
+		Penalty:          ratelimiter.Penalty{BanDuration: time.Minute},
+	}
+
+	limiter1 := ratelimiter.New(options)
+	limiter2 := ratelimiter.New(options)
+
+	ratelimitertest.AssertAllowed(t, limiter1, "test")
+	ratelimitertest.AssertDenied(t, limiter1, "test")
+
+	// the bucket is full again, but the ban set by the other instance applies
+	clock.Advance(time.Second)
+	if result := ratelimitertest.AssertDenied(t, limiter2, "test"); !result.Banned {
+		t.Errorf("Expected the ban to be shared, but it wasn't")
+	}
+
+	if err := limiter2.Unban("test"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	ratelimitertest.AssertAllowed(t, limiter1, "test")
+}
@@ -0,0 +1,136 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// Policy represents the limits applied to a particular key, such as the ones of a customer plan.
+type Policy struct {
+	Rate       Rate        // The maximum rate of events allowed.
+	MaxBurst   int         // The maximum number of events that can be bursted.
+	Bandwidths []Bandwidth // Several limits applied together. If set, Rate and MaxBurst are ignored.
+}
+
+// IsZero reports whether the policy sets no limits at all.
+func (p Policy) IsZero() bool {
+	return p.Rate.IsZero() && p.MaxBurst == 0 && len(p.Bandwidths) == 0
+}
+
+// PolicyResolver returns the policy to apply to a particular key, eg. based on the plan of the customer owning it.
+// A zero Policy applies the options of the limiter.
+type PolicyResolver func(key string) Policy
+
+// cachedPolicy represents a policy resolved for a key, that expires after some time.
+type cachedPolicy struct {
+	policy     Policy
+	expiration time.Time
+}
+
+// CachedPolicyResolver wraps a PolicyResolver so each key is only resolved once within ttl, avoiding repeated lookups on every event.
+// Resolved policies are kept in memory, and expired ones are dropped from time to time.
+// Policies expire according to the given clock, or to a monotonic clock if none is given.
+func CachedPolicyResolver(resolver PolicyResolver, ttl time.Duration, clock ...Clock) PolicyResolver {
+	var c Clock = cache.NewMonotonicClock()
+	if len(clock) > 0 && clock[0] != nil {
+		c = clock[0]
+	}
+
+	var mu sync.Mutex
+	policies := make(map[string]cachedPolicy)
+	nextSweep := c.Now().Add(ttl)
+
+	return func(key string) Policy {
+		now := c.Now()
+
+		mu.Lock()
+		cached, ok := policies[key]
+		mu.Unlock()
+
+		if ok && now.Before(cached.expiration) {
+			return cached.policy
+		}
+
+		policy := resolver(key)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if now.After(nextSweep) {
+			// drop the policies of keys not seen for a while, so the cache does not grow forever
+			for key, cached := range policies {
+				if now.After(cached.expiration) {
+					delete(policies, key)
+				}
+			}
+			nextSweep = now.Add(ttl)
+		}
+
+		policies[key] = cachedPolicy{policy: policy, expiration: now.Add(ttl)}
+		return policy
+	}
+}
+
+// policyLimiters represents the limiters created for each policy returned by a PolicyResolver.
+// Limiters for different policies share the same cache, so a key changing policy keeps its state.
+type policyLimiters struct {
+	resolver PolicyResolver          // The resolver returning the policy for each key.
+	options  Options                 // The options of the parent limiter, used for zero policies and for the cache of every limiter.
+	limiters map[string]*RateLimiter // The limiters for each distinct policy.
+	mu       sync.Mutex
+}
+
+// limiterFor returns the limiter applying the policy resolved for a particular key, creating it on first use.
+func (pl *policyLimiters) limiterFor(sourceKey string) *RateLimiter {
+	policy := pl.resolver(sourceKey)
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if policy.IsZero() {
+		policy = Policy{Rate: pl.options.Rate, MaxBurst: pl.options.MaxBurst, Bandwidths: pl.options.Bandwidths}
+	}
+
+	id := fmt.Sprint(policy)
+
+	limiter, ok := pl.limiters[id]
+	if !ok {
+		options := pl.options
+		options.MaxRatePerSecond = 0
+		options.Rate = policy.Rate
+		options.MaxBurst = policy.MaxBurst
+		options.Bandwidths = policy.Bandwidths
+		options.PolicyResolver = nil
+
+		limiter = New(options)
+		pl.limiters[id] = limiter
+	}
+
+	return limiter
+}
+
+// setOptions changes the options applied to keys resolved to a zero Policy.
+// The state of each key is kept, as limiters for all policies share the same cache.
+func (pl *policyLimiters) setOptions(change func(options *Options)) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	change(&pl.options)
+}
+
+// policy returns the policy applied by the limiter.
+func (rl *RateLimiter) policy() Policy {
+	if len(rl.bands) == 0 {
+		return Policy{Rate: rl.rate, MaxBurst: rl.maxBurst}
+	}
+
+	bandwidths := make([]Bandwidth, len(rl.bands))
+	for i, band := range rl.bands {
+		bandwidths[i] = Bandwidth{Rate: band.rate, MaxBurst: band.maxBurst}
+	}
+
+	return Policy{Bandwidths: bandwidths}
+}
@@ -0,0 +1,121 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_PolicyResolver_Applies_Limits_Per_Key(t *testing.T) {
+	plans := map[string]ratelimiter.Policy{
+		"free": {Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 2},
+		"pro":  {Rate: ratelimiter.Per(10, time.Minute), MaxBurst: 5},
+	}
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         3,
+		PolicyResolver: func(key string) ratelimiter.Policy {
+			return plans[key]
+		},
+	}
+	limiter := ratelimiter.New(options)
+
+	tests := []struct {
+		key           string
+		expectedBurst int
+		expectedLimit int
+	}{
+		{key: "free", expectedBurst: 2, expectedLimit: 1},
+		{key: "pro", expectedBurst: 5, expectedLimit: 10},
+		// keys without a plan use the limiter options
+		{key: "unknown", expectedBurst: 3, expectedLimit: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			for i := 0; i < tt.expectedBurst; i++ {
+				if !limiter.Allow(tt.key) {
+					t.Errorf("Expected limiter to allow event %d, but it didn't", i)
+				}
+			}
+
+			result, _ := limiter.Decide(tt.key)
+			if result.Allowed {
+				t.Errorf("Expected limiter to rate-limit event, but it didn't")
+			}
+
+			if result.Limit != tt.expectedLimit {
+				t.Errorf("Expected limit to be %d, but got %d", tt.expectedLimit, result.Limit)
+			}
+
+			if result.Policy.MaxBurst != tt.expectedBurst {
+				t.Errorf("Expected result policy burst to be %d, but got %d", tt.expectedBurst, result.Policy.MaxBurst)
+			}
+		})
+	}
+
+	if _, err := limiter.AllowN("free", 3); err != ratelimiter.ErrExceedsBurst {
+		t.Errorf("Expected error %v for the free plan, but got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+}
+
+func TestCachedPolicyResolver(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	calls := 0
+	resolver := ratelimiter.CachedPolicyResolver(func(key string) ratelimiter.Policy {
+		calls++
+		return ratelimiter.Policy{Rate: ratelimiter.Per(calls, time.Second), MaxBurst: 1}
+	}, 50*time.Millisecond, clock)
+
+	for i := 0; i < 5; i++ {
+		if policy := resolver("test"); policy.Rate.Events != 1 {
+			t.Errorf("Expected the cached policy, but got %v", policy)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the resolver to be called once, but it was called %d times", calls)
+	}
+
+	// Resolve again once the cached policy expires
+	clock.Advance(49 * time.Millisecond)
+	if policy := resolver("test"); policy.Rate.Events != 1 {
+		t.Errorf("Expected the cached policy, but got %v", policy)
+	}
+
+	clock.Advance(time.Millisecond)
+	if policy := resolver("test"); policy.Rate.Events != 2 {
+		t.Errorf("Expected a newly resolved policy, but got %v", policy)
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected the resolver to be called twice, but it was called %d times", calls)
+	}
+}
+
+func TestRateLimiter_PolicyResolver_SetBurst_Applies_To_Default_Policy(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:     ratelimiter.Per(1, time.Minute),
+		MaxBurst: 5,
+		PolicyResolver: func(key string) ratelimiter.Policy {
+			if key == "pro" {
+				return ratelimiter.Policy{Rate: ratelimiter.Per(1, time.Minute), MaxBurst: 10}
+			}
+			return ratelimiter.Policy{}
+		},
+	})
+
+	limiter.SetBurst(2)
+
+	if remaining := limiter.Remaining("free"); remaining != 2 {
+		t.Errorf("Expected 2 remaining events for the default policy, but got %d", remaining)
+	}
+
+	if remaining := limiter.Remaining("pro"); remaining != 10 {
+		t.Errorf("Expected 10 remaining events for the resolved policy, but got %d", remaining)
+	}
+}
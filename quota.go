@@ -0,0 +1,224 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const quotaKeyPrefix = "rl:quota:"
+
+// QuotaPeriod represents the calendar period after which a quota resets.
+type QuotaPeriod int
+
+const (
+	// Daily quotas reset at midnight.
+	Daily QuotaPeriod = iota
+	// Monthly quotas reset at midnight on the first day of each month.
+	Monthly
+)
+
+// QuotaOptions represents the options for configuring a quota.
+type QuotaOptions struct {
+	Limit         int                // The number of events allowed in each period.
+	Period        QuotaPeriod        // The calendar period after which the quota resets. Default is Daily.
+	Location      *time.Location     // The time zone whose calendar the periods follow, eg. the one of the customer. Default is UTC.
+	Cache         cache.GetterSetter // The cache to store the counters. If not provided, an in-memory cache will be used, which loses them on restarts.
+	FailurePolicy FailurePolicy      // How events are decided when cache operations fail. Default is FailOpen.
+	Clock         Clock              // The clock to read the current time from. Default is a monotonic clock.
+	Namespace     string             // Prefixes the cache keys of the quota, so quotas with different limits can share a cache.
+	KeyBuilder    KeyBuilder         // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is DefaultKeyBuilder.
+}
+
+// Quota represents a limit on the number of events allowed for each key in calendar periods, such as 50000 calls per calendar month.
+// Periods reset at calendar boundaries in the configured time zone, and counters are kept in the cache until their period ends, regardless of any time-to-live.
+type Quota struct {
+	limit         int                // The number of events allowed in each period.
+	period        QuotaPeriod        // The calendar period after which the quota resets.
+	location      *time.Location     // The time zone whose calendar the periods follow.
+	cache         cache.GetterSetter // The cache to store the counters.
+	failurePolicy FailurePolicy      // How events are decided when cache operations fail.
+	fallback      *Quota             // The local quota used while the cache fails, when the failure policy is FailLocal.
+	clock         Clock              // The clock to read the current time from.
+	keys          keySpace           // Builds the cache keys of the quota.
+}
+
+// getCountKeyFor returns the cache key under which the count of a particular key is stored for the period starting at start.
+func (q *Quota) getCountKeyFor(sourceKey string, start time.Time) string {
+	layout := "2006-01-02"
+	if q.period == Monthly {
+		layout = "2006-01"
+	}
+
+	return q.keys.keyFor(quotaKeyPrefix, sourceKey+":"+start.Format(layout))
+}
+
+// periodAt returns the start and end of the period including t.
+func (q *Quota) periodAt(t time.Time) (time.Time, time.Time) {
+	year, month, day := t.In(q.location).Date()
+
+	if q.period == Monthly {
+		start := time.Date(year, month, 1, 0, 0, 0, 0, q.location)
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	start := time.Date(year, month, day, 0, 0, 0, 0, q.location)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Allow checks if an event is allowed for a particular key in the current period, counting it if so.
+// If cache operations fail, the decision follows the failure policy.
+func (q *Quota) Allow(sourceKey string) bool {
+	result, _ := q.DecideNCtx(context.Background(), sourceKey, 1)
+	return result.Allowed
+}
+
+// Decide works like Allow, but returns the result along with the error of failed cache operations.
+// The result reports the end of the current period in ResetAt.
+func (q *Quota) Decide(sourceKey string) (Result, error) {
+	return q.DecideNCtx(context.Background(), sourceKey, 1)
+}
+
+// DecideN checks if there is room for an event costing n in the current period for a particular key, counting it if so.
+// If n is greater than the limit, the event can never be allowed and ErrExceedsBurst is returned.
+// If cache operations fail, the result follows the failure policy and the cache error is returned.
+func (q *Quota) DecideN(sourceKey string, n int) (Result, error) {
+	return q.DecideNCtx(context.Background(), sourceKey, n)
+}
+
+// DecideNCtx works like DecideN, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (q *Quota) DecideNCtx(ctx context.Context, sourceKey string, n int) (Result, error) {
+	now := q.clock.Now()
+	start, end := q.periodAt(now)
+
+	if n > q.limit {
+		return Result{Limit: q.limit, ResetAfter: end.Sub(now), ResetAt: end, RetryAfter: time.Duration(math.MaxInt64)}, ErrExceedsBurst
+	}
+
+	if n <= 0 {
+		n = 0
+	}
+
+	key := q.getCountKeyFor(sourceKey, start)
+	c := withContext(q.cache, ctx)
+
+	// counters only need to last until their period ends, rounded up so they don't outlive it without an expiration
+	expiration := ceilMilliseconds(end.Sub(now))
+	count, err := incrementCount(c, key, n, expiration)
+	if err != nil {
+		return q.failedTake(ctx, sourceKey, n, now, end), cacheError(err)
+	}
+
+	allowed := count <= q.limit
+	if !allowed {
+		// give the events back, so denied events don't count against the quota
+		if count, err = incrementCount(c, key, -n, expiration); err != nil {
+			// the events are denied either way, and an overcounted period still ends on time
+			count = q.limit
+		}
+	}
+
+	result := Result{
+		Allowed:    allowed,
+		Remaining:  q.limit - count,
+		Limit:      q.limit,
+		ResetAfter: end.Sub(now),
+		ResetAt:    end,
+	}
+
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if result.Remaining < n {
+		result.RetryAfter = end.Sub(now)
+	}
+
+	return result, nil
+}
+
+// Used returns the number of events counted for a particular key in the current period.
+// It returns an error if cache operations fail.
+func (q *Quota) Used(sourceKey string) (int, error) {
+	start, _ := q.periodAt(q.clock.Now())
+
+	count, err := q.cache.Get(q.getCountKeyFor(sourceKey, start))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return 0, cacheError(err)
+	}
+
+	return count, nil
+}
+
+// Remaining returns the number of events still allowed for a particular key in the current period.
+// It returns an error if cache operations fail.
+func (q *Quota) Remaining(sourceKey string) (int, error) {
+	used, err := q.Used(sourceKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if used > q.limit {
+		return 0, nil
+	}
+
+	return q.limit - used, nil
+}
+
+// ResetAt returns the time when the current period ends and the quota of every key resets.
+func (q *Quota) ResetAt() time.Time {
+	_, end := q.periodAt(q.clock.Now())
+	return end
+}
+
+// failedTake decides on an event costing n for a particular key according to the failure policy, after cache operations failed.
+func (q *Quota) failedTake(ctx context.Context, sourceKey string, n int, now, end time.Time) Result {
+	switch q.failurePolicy {
+	case FailClosed:
+		// retry a minute later, the cache may be back by then
+		return Result{Limit: q.limit, ResetAfter: end.Sub(now), ResetAt: end, RetryAfter: time.Minute}
+	case FailLocal:
+		result, _ := q.fallback.DecideNCtx(ctx, sourceKey, n)
+		return result
+	default:
+		return Result{Allowed: true, Remaining: q.limit, Limit: q.limit, ResetAfter: end.Sub(now), ResetAt: end}
+	}
+}
+
+// NewQuota creates a new ready to use Quota with the specified options.
+func NewQuota(options QuotaOptions) *Quota {
+	if options.Clock == nil {
+		options.Clock = cache.NewMonotonicClock()
+	}
+
+	if options.Cache == nil {
+		options.Cache = cache.NewInMemory(options.Clock)
+	}
+
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+
+	var fallback *Quota
+	if options.FailurePolicy == FailLocal {
+		fallbackOptions := options
+		fallbackOptions.Cache = cache.NewInMemory(options.Clock)
+		fallbackOptions.FailurePolicy = FailOpen
+
+		fallback = NewQuota(fallbackOptions)
+	}
+
+	return &Quota{
+		limit:         options.Limit,
+		period:        options.Period,
+		location:      options.Location,
+		cache:         options.Cache,
+		failurePolicy: options.FailurePolicy,
+		fallback:      fallback,
+		clock:         options.Clock,
+		keys:          newKeySpace(options.Namespace, options.KeyBuilder),
+	}
+}
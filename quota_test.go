@@ -0,0 +1,140 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestQuota_Monthly_Resets_At_The_Start_Of_The_Month_In_Its_Location(t *testing.T) {
+	location := time.FixedZone("UTC-5", -5*60*60)
+	clock := ratelimitertest.NewClock(time.Date(2024, time.January, 10, 12, 0, 0, 0, location))
+
+	quota := ratelimiter.NewQuota(ratelimiter.QuotaOptions{
+		Limit:    3,
+		Period:   ratelimiter.Monthly,
+		Location: location,
+		Cache:    cache.NewInMemory(clock),
+		Clock:    clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, quota, "customer", 3)
+
+	result := ratelimitertest.AssertDenied(t, quota, "customer")
+	if expected := time.Date(2024, time.February, 1, 0, 0, 0, 0, location); !result.ResetAt.Equal(expected) {
+		t.Errorf("Expected the quota to reset at %v, but got %v", expected, result.ResetAt)
+	}
+
+	if result.RetryAfter != result.ResetAfter {
+		t.Errorf("Expected to retry once the quota resets, in %v, but got %v", result.ResetAfter, result.RetryAfter)
+	}
+
+	// it is already February in UTC, but not in the location of the quota
+	clock.Set(time.Date(2024, time.January, 31, 23, 0, 0, 0, location))
+	ratelimitertest.AssertDenied(t, quota, "customer")
+
+	clock.Advance(time.Hour)
+	ratelimitertest.AssertAllowed(t, quota, "customer")
+}
+
+func TestQuota_Reports_Used_And_Remaining_Events(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Date(2024, time.January, 10, 8, 0, 0, 0, time.UTC))
+
+	quota := ratelimiter.NewQuota(ratelimiter.QuotaOptions{
+		Limit: 10,
+		Cache: cache.NewInMemory(clock),
+		Clock: clock,
+	})
+
+	if _, err := quota.DecideN("customer", 4); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// counters last until the end of the day, well beyond the default time-to-live of the limiters
+	clock.Advance(15 * time.Hour)
+
+	if used, err := quota.Used("customer"); err != nil || used != 4 {
+		t.Errorf("Expected 4 events used, but got %d, %v", used, err)
+	}
+
+	if remaining, err := quota.Remaining("customer"); err != nil || remaining != 6 {
+		t.Errorf("Expected 6 events remaining, but got %d, %v", remaining, err)
+	}
+
+	if expected := time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC); !quota.ResetAt().Equal(expected) {
+		t.Errorf("Expected the quota to reset at %v, but got %v", expected, quota.ResetAt())
+	}
+
+	if _, err := quota.DecideN("customer", 11); err != ratelimiter.ErrExceedsBurst {
+		t.Errorf("Expected error %v, but got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+
+	clock.Advance(time.Hour)
+
+	if used, err := quota.Used("customer"); err != nil || used != 0 {
+		t.Errorf("Expected no events used on the next day, but got %d, %v", used, err)
+	}
+}
+
+func TestQuota_Daily_Follows_Daylight_Saving_Time(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	clock := ratelimitertest.NewClock(time.Date(2024, time.March, 10, 0, 30, 0, 0, location))
+
+	quota := ratelimiter.NewQuota(ratelimiter.QuotaOptions{
+		Limit:    1,
+		Location: location,
+		Clock:    clock,
+	})
+
+	// the clocks skip an hour on that day, so it only lasts 23 hours
+	result := ratelimitertest.AssertAllowed(t, quota, "customer")
+	if expected := 22*time.Hour + 30*time.Minute; result.ResetAfter != expected {
+		t.Errorf("Expected the quota to reset after %v, but got %v", expected, result.ResetAfter)
+	}
+}
+
+func TestQuota_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		failurePolicy   ratelimiter.FailurePolicy
+		expectedAllowed int
+	}{
+		{name: "fail open", failurePolicy: ratelimiter.FailOpen, expectedAllowed: 10},
+		{name: "fail closed", failurePolicy: ratelimiter.FailClosed, expectedAllowed: 0},
+		// the local quota still applies the limit
+		{name: "fail local", failurePolicy: ratelimiter.FailLocal, expectedAllowed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota := ratelimiter.NewQuota(ratelimiter.QuotaOptions{
+				Limit:         3,
+				Cache:         &mockFailedCache{},
+				FailurePolicy: tt.failurePolicy,
+			})
+
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				result, err := quota.Decide("customer")
+				if err == nil {
+					t.Errorf("Expected the cache error, but got nil")
+				}
+
+				if result.Allowed {
+					allowed++
+				}
+			}
+
+			if allowed != tt.expectedAllowed {
+				t.Errorf("Expected quota to allow %d events, but it allowed %d", tt.expectedAllowed, allowed)
+			}
+		})
+	}
+}
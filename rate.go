@@ -0,0 +1,46 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// Rate represents a rate of events over a period of time, such as 30 events per minute.
+type Rate struct {
+	Events int           // The number of events allowed in each period.
+	Period time.Duration // The period of time in which the events are allowed.
+}
+
+// Per creates a Rate allowing the given number of events in each period, eg. Per(30, time.Minute).
+func Per(events int, period time.Duration) Rate {
+	return Rate{Events: events, Period: period}
+}
+
+// Every creates a Rate allowing one event in each interval, eg. Every(5*time.Second).
+func Every(interval time.Duration) Rate {
+	return Per(1, interval)
+}
+
+// IsZero reports whether the rate allows no events at all.
+func (r Rate) IsZero() bool {
+	return r.Events <= 0 || r.Period <= 0
+}
+
+// perMillisecond returns the number of events allowed per millisecond.
+func (r Rate) perMillisecond() float64 {
+	if r.IsZero() {
+		return 0
+	}
+
+	return float64(r.Events) / (float64(r.Period) / float64(time.Millisecond))
+}
+
+// TimeFor returns the time it takes for the rate to allow n events.
+// If the rate is zero, it returns the maximum duration.
+func (r Rate) TimeFor(n int) time.Duration {
+	if r.IsZero() {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(math.Ceil(float64(r.Period) * float64(n) / float64(r.Events)))
+}
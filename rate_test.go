@@ -0,0 +1,94 @@
+package ratelimiter_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+)
+
+func TestRate_TimeFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     ratelimiter.Rate
+		n        int
+		expected time.Duration
+	}{
+		{name: "per second", rate: ratelimiter.Per(10, time.Second), n: 5, expected: 500 * time.Millisecond},
+		{name: "per minute", rate: ratelimiter.Per(30, time.Minute), n: 30, expected: time.Minute},
+		{name: "every interval", rate: ratelimiter.Every(5 * time.Second), n: 2, expected: 10 * time.Second},
+		{name: "fractional per second", rate: ratelimiter.Per(1, 2*time.Second), n: 3, expected: 6 * time.Second},
+		{name: "zero rate", rate: ratelimiter.Rate{}, n: 1, expected: time.Duration(math.MaxInt64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rate.TimeFor(tt.n); got != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Fractional_Rate(t *testing.T) {
+	sourceKey := "test"
+
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucket,
+		ratelimiter.SlidingWindowLog,
+		ratelimiter.SlidingWindowCounter,
+		ratelimiter.FixedWindow,
+		ratelimiter.GCRA,
+	}
+
+	for _, algorithm := range algorithms {
+		// one event every 5 seconds, so the second event must wait
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Rate:      ratelimiter.Every(5 * time.Second),
+			MaxBurst:  1,
+			Algorithm: algorithm,
+		})
+
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Algorithm %d: expected limiter to allow event, but it didn't", algorithm)
+		}
+
+		result, _ := limiter.Decide(sourceKey)
+		if result.Allowed {
+			t.Errorf("Algorithm %d: expected limiter to rate-limit event, but it didn't", algorithm)
+		}
+
+		if result.Limit != 1 {
+			t.Errorf("Algorithm %d: expected limit to be 1, but got %d", algorithm, result.Limit)
+		}
+
+		// fixed windows are aligned to the wall clock, so the retry can come sooner than the interval
+		if result.RetryAfter <= 0 || result.RetryAfter > 10*time.Second {
+			t.Errorf("Algorithm %d: expected retry after to be within the window, but got %v", algorithm, result.RetryAfter)
+		}
+	}
+}
+
+func TestRateLimiter_Rate_Takes_Precedence(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 100,
+		Rate:             ratelimiter.Per(30, time.Minute),
+		MaxBurst:         1,
+	})
+
+	result, _ := limiter.Decide("test")
+	if result.Limit != 30 {
+		t.Errorf("Expected limit to be 30, but got %d", result.Limit)
+	}
+
+	// a token takes 2 seconds to refill at 30 per minute
+	result, _ = limiter.Decide("test")
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.RetryAfter < time.Second || result.RetryAfter > 2*time.Second {
+		t.Errorf("Expected retry after to be about 2 seconds, but got %v", result.RetryAfter)
+	}
+}
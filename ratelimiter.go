@@ -1,132 +1,450 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/rcdmk/go-ratelimiter/cache"
 )
 
+// ErrExceedsBurst is returned when an event costs more tokens than the maximum burst, so it can never be allowed.
+var ErrExceedsBurst = errors.New("ratelimiter: event cost exceeds maximum burst")
+
+// ErrWaitExceedsDeadline is returned when waiting for tokens would exceed the context deadline.
+var ErrWaitExceedsDeadline = errors.New("ratelimiter: wait would exceed context deadline")
+
+// Algorithm represents the algorithm used by a RateLimiter to limit the rate of events.
+type Algorithm int
+
 const (
-	bucketKeyPrefix   = "rl:bucket:"
-	lastFillKeyPrefix = "rl:fill:"
+	// TokenBucket allows bursts of up to MaxBurst events, refilling tokens at the maximum rate. This is the default algorithm.
+	TokenBucket Algorithm = iota
+	// SlidingWindowLog allows at most MaxBurst events in any rolling window lasting the time the maximum rate takes to allow MaxBurst events, keeping a log of event timestamps per key.
+	// It requires a cache implementing [cache.EventLogger], otherwise it behaves as if cache operations fail.
+	SlidingWindowLog
+	// SlidingWindowCounter approximates SlidingWindowLog by weighting the event count of the previous fixed window against the current one, storing two counters per key.
+	// It works with any cache, and counts events atomically if the cache implements [cache.CompareAndSwapper].
+	SlidingWindowCounter
+	// FixedWindow allows at most MaxBurst events in fixed windows lasting the time the maximum rate takes to allow MaxBurst events, aligned to the wall clock so windows lasting a minute reset on the minute.
+	// It counts events atomically if the cache implements [cache.Incrementer].
+	FixedWindow
+	// GCRA implements the Generic Cell Rate Algorithm, with the same burst and rate semantics as TokenBucket, storing a single theoretical arrival time per key.
+	// It updates the arrival time in a single atomic call if the cache implements [cache.Advancer].
+	GCRA
 )
 
-// RateLimiter represents a rate limiter that limits the rate of events, implemented using a token bucket algorithm.
+// RateLimiter represents a rate limiter that limits the rate of events, implemented using a token bucket algorithm by default.
 // This implementation assumes cache operations are fast, reliable and concurrency-safe.
 type RateLimiter struct {
+	algorithm             Algorithm          // The algorithm used to limit the rate of events.
+	rate                  Rate               // The maximum rate of events allowed.
 	maxRatePerMillisecond float64            // The maximum rate of events allowed per millisecond.
 	maxBurst              int                // The maximum number of events that can be bursted.
-	cache                 cache.GetterSetter // Cache to store the bucket and lastFill values.
+	countWindow           int                // The length of fixed and counter windows in milliseconds, kept across rate and burst changes so stored counts stay valid.
+	cache                 cache.GetterSetter // Cache to store the algorithm state.
 	cacheTTL              time.Duration      // The time-to-live for the cache entries.
+	bands                 []*RateLimiter     // The limiters of each bandwidth, when several limits are applied together.
+	policies              *policyLimiters    // The limiters of each policy, when policies are resolved per key.
+	failurePolicy         FailurePolicy      // How events are decided when cache operations fail.
+	fallback              *RateLimiter       // The limiter with a local cache used when cache operations fail, for the FailLocal policy.
+	clock                 Clock              // Clock to read the current time from.
+	penalty               Penalty            // The escalation applied to keys that keep exceeding the limits.
+	keys                  keySpace           // Builds the cache keys of the limiter.
+
+	mu sync.RWMutex // Guards the rate and burst, which can be changed while events are limited.
 }
 
-func (rl *RateLimiter) getBucketKeyFor(sourceKey string) string {
-	return bucketKeyPrefix + sourceKey
+// Remaining returns the number of remaining requests for the given source key.
+// If cache operations fail, the number follows the failure policy, which reports a full bucket by default.
+func (rl *RateLimiter) Remaining(sourceKey string) int {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).Remaining(sourceKey)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	return rl.remaining(context.Background(), sourceKey)
 }
 
-func (rl *RateLimiter) getLastFillKeyFor(sourceKey string) string {
-	return lastFillKeyPrefix + sourceKey
+// RemainingN returns the number of remaining events costing n tokens each for the given source key.
+// If cache operations fail, the number follows the failure policy, which reports a full bucket by default.
+func (rl *RateLimiter) RemainingN(sourceKey string, n int) int {
+	if n <= 0 {
+		return rl.Remaining(sourceKey)
+	}
+
+	return rl.Remaining(sourceKey) / n
 }
 
-// getBucketFor retrieves the current bucket value for a particular key.
-// If cache operations fail, it will always return a full bucket.
-func (rl *RateLimiter) getBucketFor(sourceKey string) int {
-	bucketKey := rl.getBucketKeyFor(sourceKey)
-	bucket, err := rl.cache.Get(bucketKey)
-	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
-		// if cache fails, bucket is always full. Allow the event to be executed
-		return rl.maxBurst
+// Allow checks if the rate wasn't exhausted for a particular key to allow or not an event to be executed.
+// If the cache implements [cache.CompareAndSwapper], the token is consumed atomically, so concurrent callers cannot overspend the bucket.
+// If cache operations fail, the decision follows the failure policy, which allows the event by default.
+func (rl *RateLimiter) Allow(sourceKey string) bool {
+	allowed, _ := rl.AllowN(sourceKey, 1)
+	return allowed
+}
+
+// AllowCtx works like Allow, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+// Cache operations given up on because ctx is done fail, so the decision follows the failure policy instead of waiting on a slow cache.
+func (rl *RateLimiter) AllowCtx(ctx context.Context, sourceKey string) bool {
+	allowed, _ := rl.AllowNCtx(ctx, sourceKey, 1)
+	return allowed
+}
+
+// AllowE works like Allow, but also returns the error of failed cache operations, in which case the decision follows the failure policy.
+func (rl *RateLimiter) AllowE(sourceKey string) (bool, error) {
+	return rl.AllowN(sourceKey, 1)
+}
+
+// AllowN checks if there are at least n tokens available for a particular key to allow or not an event costing n tokens to be executed.
+// The tokens are only consumed if all of them are available.
+// If n is greater than the maximum burst, or than a counted window allows at the current rate, the event can never be allowed and ErrExceedsBurst is returned.
+// If cache operations fail, the decision follows the failure policy and the cache error is returned.
+func (rl *RateLimiter) AllowN(sourceKey string, n int) (bool, error) {
+	return rl.AllowNCtx(context.Background(), sourceKey, n)
+}
+
+// AllowNCtx works like AllowN, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) AllowNCtx(ctx context.Context, sourceKey string, n int) (bool, error) {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).AllowNCtx(ctx, sourceKey, n)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	if rl.exceedsBurst(n) {
+		return false, ErrExceedsBurst
+	}
+
+	if n <= 0 {
+		return true, nil
 	}
 
-	return bucket
+	result, err := rl.decide(ctx, sourceKey, n)
+	return result.Allowed, err
+}
+
+// Decide checks if the rate wasn't exhausted for a particular key to allow or not an event to be executed, consuming a token if allowed.
+// The returned result carries the decision along with the bucket state after it, saving a separate call to Remaining.
+// If cache operations fail, the result follows the failure policy and the cache error is returned.
+func (rl *RateLimiter) Decide(sourceKey string) (Result, error) {
+	return rl.DecideN(sourceKey, 1)
+}
+
+// DecideN checks if there are at least n tokens available for a particular key to allow or not an event costing n tokens to be executed.
+// The tokens are only consumed if all of them are available.
+// If n is greater than the maximum burst, or than a counted window allows at the current rate, the event can never be allowed and ErrExceedsBurst is returned.
+// If cache operations fail, the result follows the failure policy and the cache error is returned.
+func (rl *RateLimiter) DecideN(sourceKey string, n int) (Result, error) {
+	return rl.DecideNCtx(context.Background(), sourceKey, n)
+}
+
+// DecideCtx works like Decide, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) DecideCtx(ctx context.Context, sourceKey string) (Result, error) {
+	return rl.DecideNCtx(ctx, sourceKey, 1)
 }
 
-// getLastFillFor retrieves the last fill time for a particular key.
-// If cache operations fail, it will always return the current time.
-func (rl *RateLimiter) getLastFillFor(sourceKey string) int {
-	lastFillKey := rl.getLastFillKeyFor(sourceKey)
-	lastFill, err := rl.cache.Get(lastFillKey)
-	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
-		// if cache fails, the bucket is always full
-		return int(time.Now().UnixMilli())
+// DecideNCtx works like DecideN, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+func (rl *RateLimiter) DecideNCtx(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).DecideNCtx(ctx, sourceKey, n)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	if rl.exceedsBurst(n) {
+		return Result{Limit: rl.rate.Events, RetryAfter: time.Duration(math.MaxInt64), Policy: rl.policy()}, ErrExceedsBurst
 	}
-	return lastFill
+
+	if n <= 0 {
+		n = 0
+	}
+
+	return rl.decide(ctx, sourceKey, n)
 }
 
-func (rl *RateLimiter) setBucketFor(sourceKey string, value int) {
-	key := rl.getBucketKeyFor(sourceKey)
-	_ = rl.cache.SetWithExpiration(key, value, rl.cacheTTL)
+// Wait blocks until a token is available for a particular key and consumes it.
+// It returns an error if the context is cancelled, or right away if the context deadline would be exceeded before the token is available.
+// Waiting sleeps on real time and ignores the clock of the limiter, so a fake clock only affects the decisions made while waiting.
+func (rl *RateLimiter) Wait(ctx context.Context, sourceKey string) error {
+	return rl.WaitN(ctx, sourceKey, 1)
 }
 
-func (rl *RateLimiter) setLastFillFor(sourceKey string, value int) {
-	key := rl.getLastFillKeyFor(sourceKey)
-	_ = rl.cache.SetWithExpiration(key, value, rl.cacheTTL)
+// WaitN blocks until n tokens are available for a particular key and consumes them.
+// If n is greater than the maximum burst, or than a counted window allows at the current rate, the event can never be allowed and ErrExceedsBurst is returned.
+// It returns an error if the context is cancelled, or ErrWaitExceedsDeadline right away if the context deadline would be exceeded before the tokens are available.
+// Waiting sleeps on real time and ignores the clock of the limiter, so a fake clock only affects the decisions made while waiting.
+func (rl *RateLimiter) WaitN(ctx context.Context, sourceKey string, n int) error {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).WaitN(ctx, sourceKey, n)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if n <= 0 {
+			return nil
+		}
+
+		// the lock is not held while waiting, so the limits can be changed in the meantime
+		rl.mu.RLock()
+		if rl.exceedsBurst(n) {
+			rl.mu.RUnlock()
+			return ErrExceedsBurst
+		}
+		// with cache operations failing, the wait follows the failure policy
+		result, _ := rl.take(ctx, sourceKey, n)
+		rl.mu.RUnlock()
+
+		if result.Allowed {
+			return nil
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < result.RetryAfter {
+			return ErrWaitExceedsDeadline
+		}
+
+		timer := time.NewTimer(result.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			// tokens may have been taken by a concurrent caller in the meantime, try again
+		}
+	}
 }
 
-// fillBucket fills the bucket with tokens based on the elapsed time since the last fill.
-func (rl *RateLimiter) fillBucket(sourceKey string) {
-	now := int(time.Now().UnixMilli())
-	lastFill := rl.getLastFillFor(sourceKey)
-	elapsed := now - lastFill
+// SetLimit changes the maximum rate of events allowed, and can be called concurrently with the other methods.
+// Stored buckets are kept, so tokens already available stay available and refill at the new rate from then on.
+// Fixed and counter windows keep their length, so events already counted stay in their windows, and the number of events allowed in each window follows the new rate.
+// Limiters configured with Bandwidths keep the rate of each band, and limiters with a PolicyResolver only apply it to keys resolved to a zero Policy.
+func (rl *RateLimiter) SetLimit(rate Rate) {
+	if rl.policies != nil {
+		rl.policies.setOptions(func(options *Options) {
+			options.Rate = rate
+		})
+		return
+	}
+
+	if rl.fallback != nil {
+		rl.fallback.SetLimit(rate)
+	}
 
-	// important to use floating points for partial bucket filling, eg. 10 tokens per second = 1 token per 0.1 seconds
-	newTokens := int(float64(elapsed) * rl.maxRatePerMillisecond)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if len(rl.bands) == 0 {
+		rl.rate = rate
+		rl.maxRatePerMillisecond = rate.perMillisecond()
+		rl.resizeCountWindow()
+	}
+}
 
-	bucket := rl.getBucketFor(sourceKey) + newTokens
+// SetBurst changes the maximum number of events that can be bursted, and can be called concurrently with the other methods.
+// Stored buckets are clamped to the new burst when they are next used, so lowering it does not leave keys above the new maximum, and raising it lets buckets refill up to it.
+// Fixed and counter windows keep their length, and allow at most the new burst in each window.
+// Limiters configured with Bandwidths keep the burst of each band, and limiters with a PolicyResolver only apply it to keys resolved to a zero Policy.
+func (rl *RateLimiter) SetBurst(burst int) {
+	if rl.policies != nil {
+		rl.policies.setOptions(func(options *Options) {
+			options.MaxBurst = burst
+		})
+		return
+	}
 
-	if bucket > rl.maxBurst {
-		bucket = rl.maxBurst
+	if rl.fallback != nil {
+		rl.fallback.SetBurst(burst)
 	}
 
-	rl.setBucketFor(sourceKey, bucket)
-	rl.setLastFillFor(sourceKey, now)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if len(rl.bands) == 0 {
+		rl.maxBurst = burst
+		rl.resizeCountWindow()
+	}
 }
 
-// Remaining returns the number of remaining requests for the given source key.
-func (rl *RateLimiter) Remaining(sourceKey string) int {
-	rl.fillBucket(sourceKey)
+// decide consumes n tokens for a particular key like take, counting denied events towards the penalty of the limiter, if any.
+// Waiting callers do not go through it, as they honour the time to retry.
+func (rl *RateLimiter) decide(ctx context.Context, sourceKey string, n int) (Result, error) {
+	result, err := rl.take(ctx, sourceKey, n)
+	if err == nil && !result.Allowed && !result.Banned {
+		result = rl.penalize(ctx, sourceKey, result)
+	}
 
-	return rl.getBucketFor(sourceKey)
+	return result, err
 }
 
-// Allow checks if the rate wasn't exhausted for a particular key to allow or not an event to be executed.
-// If cache operations fail, it will always return false.
-func (rl *RateLimiter) Allow(sourceKey string) bool {
-	rl.fillBucket(sourceKey)
+// take consumes n tokens for a particular key if they are all available and it is not banned, using the configured algorithm.
+// If cache operations fail, the result follows the failure policy and the cache error is returned.
+func (rl *RateLimiter) take(ctx context.Context, sourceKey string, n int) (Result, error) {
+	result, banned, err := rl.banResultFor(ctx, sourceKey)
+
+	switch {
+	case banned || err != nil:
+		// banned keys are denied without taking tokens
+	case len(rl.bands) > 0:
+		result, err = rl.takeFromBands(ctx, sourceKey, n)
+	case rl.algorithm == SlidingWindowLog:
+		result, err = rl.takeFromLog(ctx, sourceKey, n)
+	case rl.algorithm == SlidingWindowCounter:
+		result, err = rl.takeFromWindowCounter(ctx, sourceKey, n)
+	case rl.algorithm == FixedWindow:
+		result, err = rl.takeFromFixedWindow(ctx, sourceKey, n)
+	case rl.algorithm == GCRA:
+		result, err = rl.takeFromArrival(ctx, sourceKey, n)
+	default:
+		result, err = rl.takeFromBucket(ctx, sourceKey, n)
+	}
+
+	if err != nil {
+		result = rl.failedTake(ctx, sourceKey, n)
+		err = cacheError(err)
+	}
 
-	bucket := rl.getBucketFor(sourceKey)
-	if bucket > 0 {
-		bucket--
-		rl.setBucketFor(sourceKey, bucket)
-		return true
+	if result.ResetAt.IsZero() {
+		result.ResetAt = rl.clock.Now().Add(result.ResetAfter)
 	}
 
-	return false
+	result.Policy = rl.policy()
+
+	return result, err
+}
+
+// cacheFor returns the cache bound to ctx if it implements [cache.ContextGetterSetter], or the cache itself otherwise.
+func (rl *RateLimiter) cacheFor(ctx context.Context) cache.GetterSetter {
+	return withContext(rl.cache, ctx)
+}
+
+// withContext returns c bound to ctx if it implements [cache.ContextGetterSetter], or c itself otherwise.
+func withContext(c cache.GetterSetter, ctx context.Context) cache.GetterSetter {
+	if contextCache, ok := c.(cache.ContextGetterSetter); ok {
+		return contextCache.WithContext(ctx)
+	}
+
+	return c
+}
+
+// remaining returns the number of tokens available for a particular key without consuming them, using the configured algorithm.
+// If cache operations fail, the number follows the failure policy.
+func (rl *RateLimiter) remaining(ctx context.Context, sourceKey string) int {
+	remaining, err := rl.remainingFor(ctx, sourceKey)
+	if err != nil {
+		return rl.failedRemaining(sourceKey)
+	}
+
+	return remaining
+}
+
+// remainingFor returns the number of tokens available for a particular key without consuming them, using the configured algorithm.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingFor(ctx context.Context, sourceKey string) (int, error) {
+	switch {
+	case len(rl.bands) > 0:
+		return rl.remainingInBands(ctx, sourceKey)
+	case rl.algorithm == SlidingWindowLog:
+		return rl.remainingInLog(ctx, sourceKey)
+	case rl.algorithm == SlidingWindowCounter:
+		return rl.remainingInWindowCounter(ctx, sourceKey)
+	case rl.algorithm == FixedWindow:
+		return rl.remainingInFixedWindow(ctx, sourceKey)
+	case rl.algorithm == GCRA:
+		return rl.remainingInArrival(ctx, sourceKey)
+	default:
+		return rl.remainingInBucket(ctx, sourceKey)
+	}
 }
 
 // Options represents the options for configuring a RateLimiter.
 type Options struct {
-	MaxRatePerSecond int                // The maximum rate of events allowed per second.
+	MaxRatePerSecond int                // The maximum rate of events allowed per second. Ignored if Rate is set.
+	Rate             Rate               // The maximum rate of events allowed, for rates that are not whole events per second, eg. Per(30, time.Minute).
 	MaxBurst         int                // The maximum number of events that can be bursted.
 	Cache            cache.GetterSetter // The cache to store the bucket and lastFill values. If not provided, an in-memory cache will be used.
-	CacheTTL         time.Duration      // The time-to-live for the cache entries. Default is 10 seconds.
+	CacheTTL         time.Duration      // The time-to-live for the cache entries. Default is 10 seconds. Token buckets are kept at least until they would be full again.
+	Algorithm        Algorithm          // The algorithm used to limit the rate of events. Default is TokenBucket.
+	Bandwidths       []Bandwidth        // Several limits applied together, eg. 10 per second and 1000 per hour. If set, Rate, MaxRatePerSecond and MaxBurst are ignored and the TokenBucket algorithm is used for every band.
+	PolicyResolver   PolicyResolver     // Resolves the limits applied to each key, eg. based on customer plans. Keys resolved to a zero Policy use the other options.
+	FailurePolicy    FailurePolicy      // How events are decided when cache operations fail. Default is FailOpen.
+	Clock            Clock              // The clock to read the current time from, which is also used by the default in-memory cache. Default is a monotonic clock.
+	Penalty          Penalty            // Bans keys that keep exceeding the limits, with bans growing exponentially. Disabled by default.
+	Namespace        string             // Prefixes the cache keys of the limiter, so limiters with different limits can share a cache, eg. one per product.
+	KeyBuilder       KeyBuilder         // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is DefaultKeyBuilder.
 }
 
+// Clock represents a source of the current time, so time can be controlled in tests. See package ratelimitertest for a fake implementation.
+// Clocks only provide the current time, so the waiting APIs, such as Wait, still sleep on real time.
+type Clock = cache.Clock
+
 // New creates a new ready to use RateLimiter with the specified options.
 func New(options Options) *RateLimiter {
+	if options.Clock == nil {
+		options.Clock = cache.NewMonotonicClock()
+	}
+
 	if options.Cache == nil {
-		options.Cache = cache.NewInMemory()
+		options.Cache = cache.NewInMemory(options.Clock)
 	}
 
 	if options.CacheTTL == 0 {
 		options.CacheTTL = 10 * time.Second
 	}
 
-	return &RateLimiter{
-		maxRatePerMillisecond: float64(options.MaxRatePerSecond) / 1000.0,
+	if options.Rate.IsZero() {
+		options.Rate = Per(options.MaxRatePerSecond, time.Second)
+	}
+
+	var policies *policyLimiters
+	if options.PolicyResolver != nil {
+		policies = &policyLimiters{
+			resolver: options.PolicyResolver,
+			options:  options,
+			limiters: make(map[string]*RateLimiter),
+		}
+	}
+
+	var fallback *RateLimiter
+	if options.PolicyResolver == nil {
+		// the limiters of each policy have their own fallbacks
+		fallback = newFallback(options)
+	}
+
+	var bands []*RateLimiter
+	if len(options.Bandwidths) > 0 {
+		bands = newBands(options.Bandwidths, options)
+
+		// the first band is reported when cache operations fail, and events costing more than the smallest burst can never be allowed
+		options.Algorithm = TokenBucket
+		options.Rate = options.Bandwidths[0].Rate
+		options.MaxBurst = minBurst(options.Bandwidths)
+	}
+
+	rl := &RateLimiter{
+		algorithm:             options.Algorithm,
+		rate:                  options.Rate,
+		maxRatePerMillisecond: options.Rate.perMillisecond(),
 		maxBurst:              options.MaxBurst,
 		cache:                 options.Cache,
 		cacheTTL:              options.CacheTTL,
+		bands:                 bands,
+		policies:              policies,
+		failurePolicy:         options.FailurePolicy,
+		fallback:              fallback,
+		clock:                 options.Clock,
+		penalty:               normalizePenalty(options.Penalty),
+		keys:                  newKeySpace(options.Namespace, options.KeyBuilder),
 	}
+	rl.countWindow = rl.windowMilliseconds()
+
+	return rl
 }
@@ -1,19 +1,25 @@
 package ratelimiter_test
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
 )
 
 func TestRateLimiter_Allow(t *testing.T) {
 	sourceKey := "test"
+	clock := ratelimitertest.NewClock(time.Time{})
 
 	options := ratelimiter.Options{
 		MaxRatePerSecond: 10,
 		MaxBurst:         5,
+		Clock:            clock,
 	}
 	limiter := ratelimiter.New(options)
 
@@ -25,7 +31,7 @@ func TestRateLimiter_Allow(t *testing.T) {
 	}
 
 	// Allow 5 more events after waiting for 1 second
-	time.Sleep(time.Second)
+	clock.Advance(time.Second)
 	for i := 0; i < 5; i++ {
 		if !limiter.Allow(sourceKey) {
 			t.Errorf("Expected limiter to allow event, but it didn't")
@@ -71,10 +77,12 @@ func TestRateLimiter_Allow_ZeroBurst(t *testing.T) {
 
 func TestRateLimiter_Allow_BurstHigherThanMaxRate(t *testing.T) {
 	sourceKey := "test"
+	clock := ratelimitertest.NewClock(time.Time{})
 
 	options := ratelimiter.Options{
 		MaxRatePerSecond: 10,
 		MaxBurst:         15,
+		Clock:            clock,
 	}
 	limiter := ratelimiter.New(options)
 
@@ -91,7 +99,7 @@ func TestRateLimiter_Allow_BurstHigherThanMaxRate(t *testing.T) {
 	}
 
 	// Allow 10 more events after waiting for 1 second
-	time.Sleep(time.Second)
+	clock.Advance(time.Second)
 	for i := 0; i < 10; i++ {
 		if !limiter.Allow(sourceKey) {
 			t.Errorf("Expected limiter to allow event, but it didn't")
@@ -139,6 +147,101 @@ func TestRateLimiter_Allow_Multiple_Keys(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_Allow_Keeps_Partial_Refill_When_Polled_Frequently(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 20,
+		MaxBurst:         20,
+		Clock:            clock,
+	}
+
+	limiter := ratelimiter.New(options)
+
+	// Poll every 25 milliseconds for 1 second, each poll only refilling half a token
+	allowed := 0
+	for i := 0; i < 40; i++ {
+		if limiter.Allow(sourceKey) {
+			allowed++
+		}
+		clock.Advance(25 * time.Millisecond)
+	}
+
+	// the full burst plus a token refilled every 50 milliseconds until the last poll at 975 milliseconds, which are lost if partial tokens are thrown away
+	if allowed != 39 {
+		t.Errorf("Expected limiter to allow 39 events, but it allowed %d", allowed)
+	}
+}
+
+func TestRateLimiter_Allow_Keeps_Partial_Refill_At_Low_Rates(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	options := ratelimiter.Options{
+		Rate:     ratelimiter.Per(4, time.Second),
+		MaxBurst: 2,
+		Clock:    clock,
+	}
+
+	limiter := ratelimiter.New(options)
+
+	// Spend 2 tokens 150 milliseconds apart, so the second one is taken with a partial token of progress
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+	clock.Advance(150 * time.Millisecond)
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+
+	// the token started refilling with the first event, so it is ready 250 milliseconds after it
+	clock.Advance(99 * time.Millisecond)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+	clock.Advance(time.Millisecond)
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+}
+
+func TestRateLimiter_Allow_Keeps_Buckets_Until_Full_At_Slow_Rates(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// buckets take longer than the default time-to-live of 10 seconds to refill
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:     ratelimiter.Per(1, time.Minute),
+		MaxBurst: 1,
+		Clock:    clock,
+	})
+
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+	clock.Advance(11 * time.Second)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+	clock.Advance(49 * time.Second)
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+
+	limiter = ratelimiter.New(ratelimiter.Options{
+		Rate:     ratelimiter.Every(5 * time.Second),
+		MaxBurst: 3,
+		Clock:    clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, sourceKey, 3)
+	clock.Advance(11 * time.Second)
+	ratelimitertest.AssertAllowedN(t, limiter, sourceKey, 2)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+
+	// the time-to-live follows rate changes
+	limiter = ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		Clock:            clock,
+	})
+	limiter.SetLimit(ratelimiter.Per(1, time.Minute))
+
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+	clock.Advance(11 * time.Second)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+}
+
 func TestRateLimiter_Allow_Always_If_Cache_Fails(t *testing.T) {
 	sourceKey := "test"
 
@@ -158,6 +261,246 @@ func TestRateLimiter_Allow_Always_If_Cache_Fails(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_AllowN(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         10,
+	}
+	limiter := ratelimiter.New(options)
+
+	allowed, err := limiter.AllowN(sourceKey, 7)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !allowed {
+		t.Errorf("Expected limiter to allow event, but it didn't")
+	}
+
+	// Try to allow an event costing more than the remaining tokens, which should be rate-limited without consuming them
+	allowed, _ = limiter.AllowN(sourceKey, 4)
+	if allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 3 {
+		t.Errorf("Expected %d remaining tokens, got %d", 3, remaining)
+	}
+
+	if remaining := limiter.RemainingN(sourceKey, 2); remaining != 1 {
+		t.Errorf("Expected %d remaining events, got %d", 1, remaining)
+	}
+
+	allowed, _ = limiter.AllowN(sourceKey, 3)
+	if !allowed {
+		t.Errorf("Expected limiter to allow event, but it didn't")
+	}
+}
+
+func TestRateLimiter_AllowN_Exceeding_Burst_Can_Never_Succeed(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	allowed, err := limiter.AllowN(sourceKey, 6)
+	if !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+
+	if allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 5 {
+		t.Errorf("Expected %d remaining tokens, got %d", 5, remaining)
+	}
+}
+
+func TestRateLimiter_Decide(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         2,
+	}
+	limiter := ratelimiter.New(options)
+
+	result, err := limiter.Decide(sourceKey)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if !result.Allowed || result.Remaining != 1 || result.Limit != 10 || result.RetryAfter != 0 {
+		t.Errorf("Expected event to be allowed with 1 remaining token, got %+v", result)
+	}
+
+	if result.ResetAfter <= 0 || result.ResetAfter > 100*time.Millisecond {
+		t.Errorf("Expected bucket to be full within 100ms, got %v", result.ResetAfter)
+	}
+
+	result, _ = limiter.Decide(sourceKey)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected event to be allowed with no remaining tokens, got %+v", result)
+	}
+
+	if result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+		t.Errorf("Expected next token within 100ms, got %v", result.RetryAfter)
+	}
+
+	if result.ResetAfter <= 100*time.Millisecond || result.ResetAfter > 200*time.Millisecond {
+		t.Errorf("Expected bucket to be full within 200ms, got %v", result.ResetAfter)
+	}
+
+	result, _ = limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if !errors.Is(result.Err(), ratelimiter.ErrRateLimited) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrRateLimited, result.Err())
+	}
+}
+
+func TestRateLimiter_DecideN_Exceeding_Burst_Can_Never_Succeed(t *testing.T) {
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	result, err := limiter.DecideN("test", 6)
+	if !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         1,
+	}
+	limiter := ratelimiter.New(options)
+
+	ctx := context.Background()
+
+	if err := limiter.Wait(ctx, sourceKey); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// Next token is available after 100 milliseconds
+	start := time.Now()
+	if err := limiter.Wait(ctx, sourceKey); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("Expected to wait around 100ms for the next token, but waited %v", elapsed)
+	}
+}
+
+func TestRateLimiter_Wait_Fails_Right_Away_If_Deadline_Is_Too_Soon(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+	}
+	limiter := ratelimiter.New(options)
+
+	_ = limiter.Wait(context.Background(), sourceKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := limiter.Wait(ctx, sourceKey)
+	if !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrWaitExceedsDeadline, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected to fail right away, but waited %v", elapsed)
+	}
+}
+
+func TestRateLimiter_Wait_Honours_Context_Cancellation(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+	}
+	limiter := ratelimiter.New(options)
+
+	_ = limiter.Wait(context.Background(), sourceKey)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := limiter.Wait(ctx, sourceKey)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestRateLimiter_WaitN_Exceeding_Burst_Can_Never_Succeed(t *testing.T) {
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	err := limiter.WaitN(context.Background(), "test", 6)
+	if !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrExceedsBurst, err)
+	}
+}
+
+func TestRateLimiter_Allow_Does_Not_Overspend_Under_Concurrency(t *testing.T) {
+	sourceKey := "test"
+	maxBurst := 50
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         maxBurst,
+	}
+	limiter := ratelimiter.New(options)
+
+	var allowed int64
+	var wg sync.WaitGroup
+
+	// 100 goroutines competing for the same bucket
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if limiter.Allow(sourceKey) {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// one extra token may be refilled while the test runs
+	if allowed < int64(maxBurst) || allowed > int64(maxBurst+1) {
+		t.Errorf("Expected limiter to allow %d events, but it allowed %d", maxBurst, allowed)
+	}
+}
+
 // mockFailedCache is a mock implementation of the cache.GetterSetter interface that fails on all operations.
 type mockFailedCache struct{}
 
@@ -172,3 +515,162 @@ func (c *mockFailedCache) Set(key string, value int) error {
 func (c *mockFailedCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
 	return errors.New("mock cache error: set with expiration")
 }
+
+func TestRateLimiter_SetBurst_Clamps_Stored_Buckets(t *testing.T) {
+	sourceKey := "test"
+
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucket,
+		ratelimiter.SlidingWindowLog,
+		ratelimiter.SlidingWindowCounter,
+		ratelimiter.FixedWindow,
+		ratelimiter.GCRA,
+	}
+
+	for _, algorithm := range algorithms {
+		clock := ratelimitertest.NewClock(time.Time{})
+
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Rate:      ratelimiter.Per(10, time.Minute),
+			MaxBurst:  10,
+			Algorithm: algorithm,
+			Clock:     clock,
+		})
+
+		if allowed, _ := limiter.AllowN(sourceKey, 2); !allowed {
+			t.Errorf("Algorithm %d: expected limiter to allow events, but it didn't", algorithm)
+		}
+
+		// 8 tokens are left, above the new burst
+		limiter.SetBurst(5)
+
+		if remaining := limiter.Remaining(sourceKey); remaining > 5 {
+			t.Errorf("Algorithm %d: expected at most 5 remaining events, but got %d", algorithm, remaining)
+		}
+
+		if _, err := limiter.AllowN(sourceKey, 6); err != ratelimiter.ErrExceedsBurst {
+			t.Errorf("Algorithm %d: expected error %v, but got %v", algorithm, ratelimiter.ErrExceedsBurst, err)
+		}
+
+		// exhausted keys stay denied when the burst or the rate changes
+		limiter = ratelimiter.New(ratelimiter.Options{
+			Rate:      ratelimiter.Per(10, time.Minute),
+			MaxBurst:  10,
+			Algorithm: algorithm,
+			Clock:     clock,
+		})
+
+		if allowed, _ := limiter.AllowN(sourceKey, 10); !allowed {
+			t.Errorf("Algorithm %d: expected limiter to allow events, but it didn't", algorithm)
+		}
+
+		limiter.SetBurst(9)
+		if limiter.Allow(sourceKey) {
+			t.Errorf("Algorithm %d: expected limiter to rate-limit event after lowering the burst, but it didn't", algorithm)
+		}
+
+		limiter.SetLimit(ratelimiter.Per(12, time.Minute))
+		if limiter.Allow(sourceKey) {
+			t.Errorf("Algorithm %d: expected limiter to rate-limit event after raising the rate, but it didn't", algorithm)
+		}
+	}
+}
+
+func TestRateLimiter_SetLimit_Keeps_Stored_Buckets(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:     ratelimiter.Per(1, time.Minute),
+		MaxBurst: 3,
+		Clock:    clock,
+	})
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	// the empty bucket is kept, and refills at the new rate
+	limiter.SetLimit(ratelimiter.Per(20, time.Second))
+
+	result, _ := limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.Limit != 20 {
+		t.Errorf("Expected limit to be 20, but got %d", result.Limit)
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	if !limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to allow event at the new rate, but it didn't")
+	}
+}
+
+func TestRateLimiter_SetLimit_Rejects_Events_Exceeding_Window_Limit(t *testing.T) {
+	sourceKey := "test"
+
+	for _, algorithm := range []ratelimiter.Algorithm{ratelimiter.SlidingWindowCounter, ratelimiter.FixedWindow} {
+		clock := ratelimitertest.NewClock(time.Time{})
+
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Algorithm: algorithm,
+			Rate:      ratelimiter.Per(10, time.Second),
+			MaxBurst:  10,
+			Clock:     clock,
+		})
+
+		// the one second window can't count more than 2 events at the new rate, even with a burst of 10
+		limiter.SetLimit(ratelimiter.Per(2, time.Second))
+
+		if _, err := limiter.DecideN(sourceKey, 5); !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+			t.Errorf("Algorithm %d: expected error %v from DecideN, got %v", algorithm, ratelimiter.ErrExceedsBurst, err)
+		}
+
+		if _, err := limiter.AllowN(sourceKey, 5); !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+			t.Errorf("Algorithm %d: expected error %v from AllowN, got %v", algorithm, ratelimiter.ErrExceedsBurst, err)
+		}
+
+		if err := limiter.WaitN(context.Background(), sourceKey, 5); !errors.Is(err, ratelimiter.ErrExceedsBurst) {
+			t.Errorf("Algorithm %d: expected error %v from WaitN, got %v", algorithm, ratelimiter.ErrExceedsBurst, err)
+		}
+
+		if allowed, err := limiter.AllowN(sourceKey, 2); !allowed || err != nil {
+			t.Errorf("Algorithm %d: expected limiter to allow events within the window limit, got %t, %v", algorithm, allowed, err)
+		}
+	}
+}
+
+func TestRateLimiter_SetLimit_And_SetBurst_Are_Safe_Under_Concurrency(t *testing.T) {
+	sourceKey := "test"
+
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         10,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				limiter.Allow(sourceKey)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			limiter.SetLimit(ratelimiter.Per(i+1, time.Second))
+			limiter.SetBurst(i + 1)
+		}(i)
+	}
+	wg.Wait()
+
+	if remaining := limiter.Remaining(sourceKey); remaining > 10 {
+		t.Errorf("Expected remaining events to be within the burst, but got %d", remaining)
+	}
+}
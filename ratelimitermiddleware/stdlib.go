@@ -1,7 +1,9 @@
 package ratelimitermiddleware
 
 import (
+	"bufio"
 	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,39 +14,153 @@ import (
 
 // Options represents the options for configuring rate limiter middleware.
 type Options struct {
-	MaxRatePerSecond int                // The maximum rate of events allowed per second.
-	MaxBurst         int                // The maximum number of events that can be bursted.
-	SourceHeaderKey  string             // The key in the request header to use as the rate limiting key.
-	Cache            cache.GetterSetter // The cache to use for storing rate limiting data.
-	CacheTTL         time.Duration      // The time-to-live for rate limiting data in the cache.
+	MaxRatePerSecond int                        // The maximum rate of events allowed per second. Ignored if Rate is set.
+	Rate             ratelimiter.Rate           // The maximum rate of events allowed, for rates that are not whole events per second, eg. ratelimiter.Per(30, time.Minute).
+	MaxBurst         int                        // The maximum number of events that can be bursted.
+	SourceHeaderKey  string                     // The key in the request header to use as the rate limiting key.
+	Cache            cache.GetterSetter         // The cache to use for storing rate limiting data.
+	CacheTTL         time.Duration              // The time-to-live for rate limiting data in the cache.
+	Algorithm        ratelimiter.Algorithm      // The algorithm used to limit the rate of requests. Default is ratelimiter.TokenBucket.
+	Bandwidths       []ratelimiter.Bandwidth    // Several limits applied together, eg. 10 per second and 1000 per hour. If set, Rate, MaxRatePerSecond and MaxBurst are ignored, and the headers report the binding limit.
+	PolicyResolver   ratelimiter.PolicyResolver // Resolves the limits applied to each source, eg. based on customer plans, so the headers reflect the plan of each caller.
+	FailurePolicy    ratelimiter.FailurePolicy  // How requests are decided when cache operations fail, eg. ratelimiter.FailClosed for login endpoints. Default is ratelimiter.FailOpen.
+	Clock            ratelimiter.Clock          // The clock to read the current time from, eg. a fake clock from package ratelimitertest in tests. Default is a monotonic clock.
+	Penalty          ratelimiter.Penalty        // Bans sources that keep exceeding the limits, eg. credential-stuffing bots, responding with the time left in the ban in the Retry-After header.
+	Adaptation       ratelimiter.Adaptation     // Adapts the rate to the responses of the next handler when MaxRate is set: 429, 502, 503 and 504 statuses and slow responses decrease it, and other responses increase it. Rate is the initial rate.
+	Namespace        string                     // Prefixes the cache keys of the middleware, so middlewares with different limits can share a cache and the same source header values.
+	KeyBuilder       ratelimiter.KeyBuilder     // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is ratelimiter.DefaultKeyBuilder.
+}
+
+// statusRecorder wraps a response writer to record the status of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status of the response before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the wrapped response writer, so http.ResponseController can reach it.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush sends buffered data to the client if the wrapped response writer implements http.Flusher, so streaming handlers keep working.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection if the wrapped response writer implements http.Hijacker, eg. to upgrade it to a WebSocket.
+// It returns http.ErrNotSupported otherwise.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	return hijacker.Hijack()
+}
+
+// isOverload returns whether a response status signals that the next handler or its dependencies are overloaded.
+func isOverload(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// burstResetSeconds returns the seconds the rate takes to allow a full burst again, for the band that bound a decision.
+func burstResetSeconds(result ratelimiter.Result) string {
+	rate, burst := result.Policy.Rate, result.Policy.MaxBurst
+	if len(result.Policy.Bandwidths) > 0 {
+		rate, burst = result.Policy.Bandwidths[result.Band].Rate, result.Policy.Bandwidths[result.Band].MaxBurst
+	}
+
+	return strconv.FormatFloat(math.Floor(rate.TimeFor(burst).Seconds()), 'f', 0, 64)
 }
 
 // StdLib wraps a standard lib handler in a rate limiter middleware.
 // It returns an http.Handler that applies rate limiting to incoming requests, compatible with standard lib and frameworks that accept the same interface.
 func StdLib(next http.Handler, options Options) http.Handler {
-	limiter := ratelimiter.New(ratelimiter.Options{
-		MaxRatePerSecond: options.MaxRatePerSecond,
-		MaxBurst:         options.MaxBurst,
-		Cache:            options.Cache,
-		CacheTTL:         options.CacheTTL,
-	})
+	if options.Rate.IsZero() {
+		options.Rate = ratelimiter.Per(options.MaxRatePerSecond, time.Second)
+	}
+
+	if options.Clock == nil {
+		options.Clock = cache.NewMonotonicClock()
+	}
+
+	limiterOptions := ratelimiter.Options{
+		Rate:           options.Rate,
+		MaxBurst:       options.MaxBurst,
+		Cache:          options.Cache,
+		CacheTTL:       options.CacheTTL,
+		Algorithm:      options.Algorithm,
+		Bandwidths:     options.Bandwidths,
+		PolicyResolver: options.PolicyResolver,
+		FailurePolicy:  options.FailurePolicy,
+		Clock:          options.Clock,
+		Penalty:        options.Penalty,
+		Namespace:      options.Namespace,
+		KeyBuilder:     options.KeyBuilder,
+	}
+
+	var limiter *ratelimiter.RateLimiter
+	var adaptive *ratelimiter.AdaptiveLimiter
+	if options.Adaptation.MaxRate.IsZero() {
+		limiter = ratelimiter.New(limiterOptions)
+	} else {
+		adaptive = ratelimiter.NewAdaptive(limiterOptions, options.Adaptation)
+		limiter = adaptive.RateLimiter
+	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		key := r.Header.Get(options.SourceHeaderKey)
 
-		burstResetSeconds := strconv.FormatFloat(math.Floor(float64(options.MaxBurst)/float64(options.MaxRatePerSecond)), 'f', 0, 64)
+		result, _ := limiter.DecideCtx(r.Context(), key)
+
+		resetSeconds := burstResetSeconds(result)
+		switch {
+		case result.Banned:
+			// banned sources can only retry once the ban ends
+			resetSeconds = strconv.FormatFloat(math.Ceil(result.RetryAfter.Seconds()), 'f', 0, 64)
+		case options.Algorithm == ratelimiter.FixedWindow:
+			// fixed windows reset at the same time for all requests in the window
+			resetSeconds = strconv.FormatFloat(math.Ceil(result.ResetAt.Sub(options.Clock.Now()).Seconds()), 'f', 0, 64)
+		}
 
-		w.Header().Add("RateLimit-Limit", strconv.Itoa(options.MaxRatePerSecond))
-		w.Header().Add("RateLimit-Reset", burstResetSeconds)
-		w.Header().Add("RateLimit-Remaining", strconv.Itoa(limiter.Remaining(key)))
+		w.Header().Add("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Add("RateLimit-Reset", resetSeconds)
+		w.Header().Add("RateLimit-Remaining", strconv.Itoa(result.Remaining))
 
-		if !limiter.Allow(key) {
-			w.Header().Add("Retry-After", burstResetSeconds)
-			w.Header().Add("RateLimit-Remaining", "0")
+		if !result.Allowed {
+			w.Header().Add("Retry-After", resetSeconds)
 			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if adaptive == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := options.Clock.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		if isOverload(recorder.status) {
+			adaptive.Report(ratelimiter.Overload)
+			return
+		}
+
+		adaptive.ReportLatency(options.Clock.Now().Sub(start))
 	})
 }
@@ -1,11 +1,19 @@
 package ratelimitermiddleware_test
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/cache"
 	. "github.com/rcdmk/go-ratelimiter/ratelimitermiddleware"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
 )
 
 func Test_StdLib_Allows_Requests_For_Different_Sources(t *testing.T) {
@@ -161,8 +169,9 @@ func Test_StdLib_Ads_Proper_Headers_To_Response(t *testing.T) {
 			requestCount:       5,
 			expectedLastStatus: http.StatusOK,
 			expectedHeaders: map[string]string{
-				"RateLimit-Limit": "5",
-				"RateLimit-Reset": "2",
+				"RateLimit-Limit":     "5",
+				"RateLimit-Reset":     "2",
+				"RateLimit-Remaining": "5",
 			},
 		},
 		{
@@ -170,8 +179,9 @@ func Test_StdLib_Ads_Proper_Headers_To_Response(t *testing.T) {
 			requestCount:       10,
 			expectedLastStatus: http.StatusOK,
 			expectedHeaders: map[string]string{
-				"RateLimit-Limit": "5",
-				"RateLimit-Reset": "2",
+				"RateLimit-Limit":     "5",
+				"RateLimit-Reset":     "2",
+				"RateLimit-Remaining": "0",
 			},
 		},
 		{
@@ -232,3 +242,533 @@ func Test_StdLib_Ads_Proper_Headers_To_Response(t *testing.T) {
 		})
 	}
 }
+
+func Test_StdLib_Reports_Fixed_Window_Reset(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// 2 requests in each 2 seconds window
+	options := Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         2,
+		SourceHeaderKey:  headerKey,
+		Algorithm:        ratelimiter.FixedWindow,
+	}
+
+	middleware := StdLib(handler, options)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerKey, "test")
+
+	res := httptest.NewRecorder()
+	middleware.ServeHTTP(res, req)
+
+	reset := res.Result().Header.Get("RateLimit-Reset")
+	if reset != "1" && reset != "2" {
+		t.Errorf("Expected header RateLimit-Reset to be the seconds until the window ends, but got %s", reset)
+	}
+}
+
+func Test_StdLib_Supports_Fractional_Rates(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// 30 requests per minute, bursting up to 10
+	options := Options{
+		Rate:            ratelimiter.Per(30, time.Minute),
+		MaxBurst:        10,
+		SourceHeaderKey: headerKey,
+	}
+
+	middleware := StdLib(handler, options)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerKey, "test")
+
+	res := httptest.NewRecorder()
+	middleware.ServeHTTP(res, req)
+
+	if limit := res.Result().Header.Get("RateLimit-Limit"); limit != "30" {
+		t.Errorf("Expected header RateLimit-Limit to be 30, but got %s", limit)
+	}
+
+	// the burst takes 20 seconds to refill at 30 requests per minute
+	if reset := res.Result().Header.Get("RateLimit-Reset"); reset != "20" {
+		t.Errorf("Expected header RateLimit-Reset to be 20, but got %s", reset)
+	}
+}
+
+func Test_StdLib_Reports_The_Binding_Bandwidth(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// 5 requests per second, but only 6 per minute
+	options := Options{
+		Bandwidths: []ratelimiter.Bandwidth{
+			{Rate: ratelimiter.Per(5, time.Second), MaxBurst: 5},
+			{Rate: ratelimiter.Per(6, time.Minute), MaxBurst: 6},
+		},
+		SourceHeaderKey: headerKey,
+		Clock:           clock,
+	}
+
+	middleware := StdLib(handler, options)
+
+	tests := []struct {
+		requestCount    int
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			requestCount:   5,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "5",
+				"RateLimit-Reset":     "1",
+				"RateLimit-Remaining": "0",
+			},
+		},
+		{
+			requestCount:   2,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "6",
+				"RateLimit-Reset":     "60",
+				"RateLimit-Remaining": "0",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		if i > 0 {
+			// let the short-term band refill, so the quota binds
+			clock.Advance(time.Second)
+		}
+
+		var res *httptest.ResponseRecorder
+		for j := 0; j < tt.requestCount; j++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(headerKey, "test")
+
+			res = httptest.NewRecorder()
+			middleware.ServeHTTP(res, req)
+		}
+
+		if res.Code != tt.expectedStatus {
+			t.Errorf("Expected status code %d, but got %d", tt.expectedStatus, res.Code)
+		}
+
+		for key, value := range tt.expectedHeaders {
+			if got := res.Result().Header.Get(key); got != value {
+				t.Errorf("Expected header %s to be %s, but got %s", key, value, got)
+			}
+		}
+	}
+}
+
+func Test_StdLib_Reports_The_Policy_Of_Each_Caller(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	plans := map[string]ratelimiter.Policy{
+		"free": {Rate: ratelimiter.Per(1, time.Second), MaxBurst: 2},
+		"pro":  {Rate: ratelimiter.Per(10, time.Second), MaxBurst: 50},
+	}
+
+	options := Options{
+		SourceHeaderKey: headerKey,
+		PolicyResolver: ratelimiter.CachedPolicyResolver(func(key string) ratelimiter.Policy {
+			return plans[key]
+		}, time.Minute),
+	}
+
+	middleware := StdLib(handler, options)
+
+	tests := []struct {
+		key             string
+		expectedHeaders map[string]string
+	}{
+		{
+			key: "free",
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "1",
+				"RateLimit-Reset":     "2",
+				"RateLimit-Remaining": "1",
+			},
+		},
+		{
+			key: "pro",
+			expectedHeaders: map[string]string{
+				"RateLimit-Limit":     "10",
+				"RateLimit-Reset":     "5",
+				"RateLimit-Remaining": "49",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(headerKey, tt.key)
+
+			res := httptest.NewRecorder()
+			middleware.ServeHTTP(res, req)
+
+			for key, value := range tt.expectedHeaders {
+				if got := res.Result().Header.Get(key); got != value {
+					t.Errorf("Expected header %s to be %s, but got %s", key, value, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_StdLib_Honours_The_Failure_Policy(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		failurePolicy  ratelimiter.FailurePolicy
+		expectedStatus int
+	}{
+		{name: "fail open", failurePolicy: ratelimiter.FailOpen, expectedStatus: http.StatusOK},
+		{name: "fail closed", failurePolicy: ratelimiter.FailClosed, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options{
+				MaxRatePerSecond: 5,
+				MaxBurst:         10,
+				SourceHeaderKey:  headerKey,
+				Cache:            &mockFailedCache{},
+				FailurePolicy:    tt.failurePolicy,
+			}
+
+			middleware := StdLib(handler, options)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(headerKey, "test")
+
+			res := httptest.NewRecorder()
+			middleware.ServeHTTP(res, req)
+
+			if res.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, but got %d", tt.expectedStatus, res.Code)
+			}
+		})
+	}
+}
+
+func Test_StdLib_Passes_The_Request_Context_To_The_Cache(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	options := Options{
+		MaxRatePerSecond: 5,
+		MaxBurst:         10,
+		SourceHeaderKey:  headerKey,
+		Cache:            &mockContextCache{GetterSetter: cache.NewInMemory()},
+		FailurePolicy:    ratelimiter.FailClosed,
+	}
+
+	middleware := StdLib(handler, options)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerKey, "test")
+
+	res := httptest.NewRecorder()
+	middleware.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected status code %d with a live context, but got %d", http.StatusOK, res.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res = httptest.NewRecorder()
+	middleware.ServeHTTP(res, req.WithContext(ctx))
+
+	if res.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d with a cancelled context, but got %d", http.StatusTooManyRequests, res.Code)
+	}
+}
+
+func Test_StdLib_Bans_Sources_That_Keep_Exceeding_The_Limits(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	sharedCache := cache.NewInMemory()
+
+	options := Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		SourceHeaderKey:  headerKey,
+		Cache:            sharedCache,
+		Penalty: ratelimiter.Penalty{
+			MaxViolations: 1,
+			BanDuration:   time.Hour,
+		},
+	}
+
+	middleware := StdLib(handler, options)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerKey, "bot")
+
+	expectedRetryAfter := []string{"", "1", "3600", "3600"}
+
+	for i, expected := range expectedRetryAfter {
+		res := httptest.NewRecorder()
+		middleware.ServeHTTP(res, req)
+
+		if got := res.Header().Get("Retry-After"); got != expected {
+			t.Errorf("Expected Retry-After of request %d to be %q, but got %q", i+1, expected, got)
+		}
+	}
+
+	// sources are unbanned through a limiter sharing the cache
+	admin := ratelimiter.New(ratelimiter.Options{MaxRatePerSecond: 1, MaxBurst: 1, Cache: sharedCache})
+	if err := admin.Unban("bot"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	res := httptest.NewRecorder()
+	middleware.ServeHTTP(res, req)
+
+	if got := res.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected an unbanned source to be rate limited for 1s, but got Retry-After %q", got)
+	}
+}
+
+func Test_StdLib_Adapts_The_Rate_To_The_Responses(t *testing.T) {
+	headerKey := "Authorization"
+
+	status := http.StatusOK
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	middleware := StdLib(handler, Options{
+		MaxBurst:        100,
+		SourceHeaderKey: headerKey,
+		Clock:           clock,
+		Adaptation: ratelimiter.Adaptation{
+			MinRate: ratelimiter.Per(2, time.Second),
+			MaxRate: ratelimiter.Per(10, time.Second),
+		},
+	})
+
+	steps := []struct {
+		status        int
+		expectedLimit string
+	}{
+		{status: http.StatusServiceUnavailable, expectedLimit: "10"},
+		{status: http.StatusOK, expectedLimit: "5"},
+		// client errors say nothing about load, so they increase the rate as well
+		{status: http.StatusNotFound, expectedLimit: "6"},
+		{status: http.StatusGatewayTimeout, expectedLimit: "7"},
+		{status: http.StatusOK, expectedLimit: "4"},
+	}
+
+	for i, step := range steps {
+		status = step.status
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(headerKey, "test")
+
+		res := httptest.NewRecorder()
+		middleware.ServeHTTP(res, req)
+
+		if got := res.Header().Get("RateLimit-Limit"); got != step.expectedLimit {
+			t.Errorf("Expected RateLimit-Limit of request %d to be %s, but got %s", i+1, step.expectedLimit, got)
+		}
+
+		clock.Advance(time.Second)
+	}
+}
+
+func Test_StdLib_Keeps_Flushing_And_Hijacking_When_Adapting_The_Rate(t *testing.T) {
+	var hijackErr error
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatalf("Expected the response writer to implement http.Flusher, but it didn't")
+		}
+		flusher.Flush()
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatalf("Expected the response writer to implement http.Hijacker, but it didn't")
+		}
+		_, _, hijackErr = hijacker.Hijack()
+	})
+
+	middleware := StdLib(handler, Options{
+		MaxBurst: 10,
+		Adaptation: ratelimiter.Adaptation{
+			MaxRate: ratelimiter.Per(10, time.Second),
+		},
+	})
+
+	res := httptest.NewRecorder()
+	middleware.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !res.Flushed {
+		t.Errorf("Expected the response to be flushed, but it wasn't")
+	}
+
+	// the recorder can't be hijacked
+	if !errors.Is(hijackErr, http.ErrNotSupported) {
+		t.Errorf("Expected error %v, but got %v", http.ErrNotSupported, hijackErr)
+	}
+
+	hijackable := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	middleware.ServeHTTP(hijackable, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if hijackErr != nil || !hijackable.hijacked {
+		t.Errorf("Expected the connection to be hijacked, but got %v", hijackErr)
+	}
+}
+
+// hijackableRecorder is a response recorder implementing http.Hijacker, that records whether the connection was hijacked.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func Test_StdLib_Namespaces_Isolate_Middlewares_Sharing_A_Cache(t *testing.T) {
+	headerKey := "Authorization"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	sharedCache := cache.NewInMemory()
+
+	uploads := StdLib(handler, Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         1,
+		SourceHeaderKey:  headerKey,
+		Cache:            sharedCache,
+		Namespace:        "uploads",
+	})
+
+	search := StdLib(handler, Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         3,
+		SourceHeaderKey:  headerKey,
+		Cache:            sharedCache,
+		Namespace:        "search",
+	})
+
+	steps := []struct {
+		middleware     http.Handler
+		expectedStatus int
+	}{
+		{middleware: uploads, expectedStatus: http.StatusOK},
+		{middleware: uploads, expectedStatus: http.StatusTooManyRequests},
+		// the bucket of the uploads limits is not the one of the search limits
+		{middleware: search, expectedStatus: http.StatusOK},
+		{middleware: search, expectedStatus: http.StatusOK},
+		{middleware: search, expectedStatus: http.StatusOK},
+		{middleware: search, expectedStatus: http.StatusTooManyRequests},
+		{middleware: uploads, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for i, step := range steps {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(headerKey, "token")
+
+		res := httptest.NewRecorder()
+		step.middleware.ServeHTTP(res, req)
+
+		if res.Code != step.expectedStatus {
+			t.Errorf("Expected status %d for request %d, but got %d", step.expectedStatus, i+1, res.Code)
+		}
+	}
+}
+
+// mockFailedCache is a mock implementation of the cache.GetterSetter interface that fails on all operations.
+type mockFailedCache struct{}
+
+func (c *mockFailedCache) Get(key string) (int, error) {
+	return 0, errors.New("mock cache error: get")
+}
+
+func (c *mockFailedCache) Set(key string, value int) error {
+	return errors.New("mock cache error: set")
+}
+
+func (c *mockFailedCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
+	return errors.New("mock cache error: set with expiration")
+}
+
+// mockContextCache is a mock implementation of the cache.ContextGetterSetter interface that fails all operations once the context is done.
+type mockContextCache struct {
+	cache.GetterSetter
+	ctx context.Context
+}
+
+func (c *mockContextCache) Get(key string) (int, error) {
+	return c.GetContext(c.ctx, key)
+}
+
+func (c *mockContextCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
+	return c.SetWithExpirationContext(c.ctx, key, value, expiration)
+}
+
+func (c *mockContextCache) GetContext(ctx context.Context, key string) (int, error) {
+	if ctx != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return c.GetterSetter.Get(key)
+}
+
+func (c *mockContextCache) SetContext(ctx context.Context, key string, value int) error {
+	return c.SetWithExpirationContext(ctx, key, value, 0)
+}
+
+func (c *mockContextCache) SetWithExpirationContext(ctx context.Context, key string, value int, expiration time.Duration) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return c.GetterSetter.SetWithExpiration(key, value, expiration)
+}
+
+func (c *mockContextCache) WithContext(ctx context.Context) cache.GetterSetter {
+	return &mockContextCache{GetterSetter: c.GetterSetter, ctx: ctx}
+}
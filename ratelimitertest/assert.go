@@ -0,0 +1,49 @@
+package ratelimitertest
+
+import (
+	"testing"
+
+	"github.com/rcdmk/go-ratelimiter"
+)
+
+// Decider is implemented by the limiters the assertions can be used with, such as *ratelimiter.RateLimiter, *ratelimiter.HierarchicalLimiter and *ratelimiter.Quota.
+type Decider interface {
+	Decide(sourceKey string) (ratelimiter.Result, error)
+}
+
+// AssertAllowed fails the test if the limiter does not allow an event for the given key, consuming a token if it does.
+func AssertAllowed(t testing.TB, limiter Decider, sourceKey string) ratelimiter.Result {
+	t.Helper()
+
+	result, err := limiter.Decide(sourceKey)
+	if err != nil {
+		t.Errorf("Expected limiter to allow event for key %q, but it failed: %v", sourceKey, err)
+	} else if !result.Allowed {
+		t.Errorf("Expected limiter to allow event for key %q, but it didn't, retry after %v", sourceKey, result.RetryAfter)
+	}
+
+	return result
+}
+
+// AssertDenied fails the test if the limiter allows an event for the given key.
+func AssertDenied(t testing.TB, limiter Decider, sourceKey string) ratelimiter.Result {
+	t.Helper()
+
+	result, err := limiter.Decide(sourceKey)
+	if err != nil {
+		t.Errorf("Expected limiter to rate-limit event for key %q, but it failed: %v", sourceKey, err)
+	} else if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event for key %q, but it didn't, %d events remaining", sourceKey, result.Remaining)
+	}
+
+	return result
+}
+
+// AssertAllowedN fails the test if the limiter does not allow n consecutive events for the given key.
+func AssertAllowedN(t testing.TB, limiter Decider, sourceKey string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		AssertAllowed(t, limiter, sourceKey)
+	}
+}
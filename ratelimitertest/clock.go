@@ -0,0 +1,52 @@
+// Package ratelimitertest provides helpers for testing code that uses rate limiters, such as a fake clock that is advanced manually.
+//
+// The fake clock controls the decisions of limiters, but not the waiting APIs, such as RateLimiter.Wait, Shaper.Wait and ConcurrencyLimiter.Acquire,
+// which sleep on real time and check context deadlines against it. Tests of waiting code should either use short real delays, or advance the clock
+// and call the non-blocking APIs instead, such as Allow, Decide and Schedule.
+package ratelimitertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents a fake clock that only moves when advanced, so tests of rate limits run instantly and deterministically.
+// It implements ratelimiter.Clock and cache.Clock, and is safe for concurrent use.
+type Clock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+// NewClock creates a new Clock set to the given time.
+// If start is zero, the clock is set to a fixed arbitrary time.
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to the given time, which can be in the past to simulate wall clock jumps.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
@@ -0,0 +1,77 @@
+package ratelimitertest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestClock_Only_Moves_When_Advanced(t *testing.T) {
+	start := time.Date(2030, time.June, 1, 12, 0, 0, 0, time.UTC)
+	clock := ratelimitertest.NewClock(start)
+
+	if now := clock.Now(); !now.Equal(start) {
+		t.Errorf("Expected clock to be at %v, but got %v", start, now)
+	}
+
+	clock.Advance(time.Hour)
+	if now := clock.Now(); !now.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected clock to be at %v, but got %v", start.Add(time.Hour), now)
+	}
+
+	clock.Set(start)
+	if now := clock.Now(); !now.Equal(start) {
+		t.Errorf("Expected clock to be back at %v, but got %v", start, now)
+	}
+}
+
+func TestAssertAllowed_And_AssertDenied(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// one event per hour, tested instantly
+	limiter := ratelimiter.New(ratelimiter.Options{
+		Rate:     ratelimiter.Per(1, time.Hour),
+		MaxBurst: 2,
+		Clock:    clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 2)
+
+	result := ratelimitertest.AssertDenied(t, limiter, "test")
+	if result.RetryAfter < time.Hour || result.RetryAfter > time.Hour+time.Second {
+		t.Errorf("Expected retry after to be about 1h, but got %v", result.RetryAfter)
+	}
+
+	clock.Advance(result.RetryAfter)
+	ratelimitertest.AssertAllowed(t, limiter, "test")
+	ratelimitertest.AssertDenied(t, limiter, "test")
+}
+
+func TestAssertAllowed_Fails_When_Denied(t *testing.T) {
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         0,
+		Clock:            ratelimitertest.NewClock(time.Time{}),
+	})
+
+	fake := &recordingT{}
+	ratelimitertest.AssertAllowed(fake, limiter, "test")
+	if len(fake.errors) != 1 {
+		t.Errorf("Expected AssertAllowed to fail the test once, but got errors %q", fake.errors)
+	}
+}
+
+// recordingT is a stub of testing.TB that records the errors reported to it instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,142 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Reservation represents tokens booked in advance for a particular key, that can be used after a delay.
+type Reservation struct {
+	limiter   *RateLimiter
+	sourceKey string
+	tokens    int       // The number of tokens taken from the bucket.
+	ok        bool      // Whether the tokens could be reserved.
+	timeToAct time.Time // The time when the reserved tokens are available for use.
+
+	mu        sync.Mutex
+	cancelled bool
+}
+
+// OK returns whether the tokens could be reserved.
+// If it returns false, Delay returns the maximum duration and Cancel does nothing.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns the time to wait before using the reserved tokens.
+// Zero means the tokens can be used right away.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+
+	delay := r.timeToAct.Sub(r.limiter.clock.Now())
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+// Cancel gives the reserved tokens back to the bucket, as long as they were not used yet.
+// Tokens are considered used once the reservation delay has elapsed.
+// Calling Cancel more than once has no effect.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ok || r.cancelled || !r.limiter.clock.Now().Before(r.timeToAct) {
+		return
+	}
+	r.cancelled = true
+
+	r.limiter.mu.RLock()
+	defer r.limiter.mu.RUnlock()
+
+	_ = r.limiter.updateStateFor(context.Background(), r.sourceKey, func(stored bucketState, now int) (bucketState, bool) {
+		state := r.limiter.fillBucket(stored, now)
+
+		state.tokens += r.tokens
+		if state.tokens > r.limiter.maxBurst {
+			state.tokens = r.limiter.maxBurst
+		}
+
+		return state, true
+	})
+}
+
+// Reserve takes n tokens from the bucket for a particular key right away and returns a Reservation telling when they can be used.
+// The bucket can go into debt, so following events for the same key are delayed until it is paid back.
+// Reservations are stored in the cache, so they are visible to all limiters sharing it.
+// If n is greater than the maximum burst, or the rate is zero and there are not enough tokens, the reservation is not OK and no tokens are taken.
+// Reservations are only supported by the TokenBucket algorithm with a single bandwidth, other configurations always return reservations that are not OK.
+// If cache operations fail, the reservation follows the failure policy: it is OK and can be used right away by default, it is not OK with FailClosed, and it is taken from the local limiter with FailLocal.
+func (rl *RateLimiter) Reserve(sourceKey string, n int) *Reservation {
+	return rl.ReserveCtx(context.Background(), sourceKey, n)
+}
+
+// ReserveCtx works like Reserve, but cache operations honour the cancellation and deadline of ctx if the cache implements [cache.ContextGetterSetter].
+// Cache operations given up on because ctx is done fail, so the reservation follows the failure policy.
+func (rl *RateLimiter) ReserveCtx(ctx context.Context, sourceKey string, n int) *Reservation {
+	if rl.policies != nil {
+		return rl.policies.limiterFor(sourceKey).ReserveCtx(ctx, sourceKey, n)
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	reservation := &Reservation{
+		limiter:   rl,
+		sourceKey: sourceKey,
+		tokens:    n,
+		ok:        n <= rl.maxBurst && rl.algorithm == TokenBucket && len(rl.bands) == 0,
+		timeToAct: rl.clock.Now(),
+	}
+
+	if !reservation.ok || n <= 0 {
+		return reservation
+	}
+
+	_, banned, err := rl.banResultFor(ctx, sourceKey)
+	if banned {
+		reservation.ok = false
+		return reservation
+	}
+
+	if err == nil {
+		err = rl.updateStateFor(ctx, sourceKey, func(stored bucketState, now int) (bucketState, bool) {
+			state := rl.fillBucket(stored, now)
+
+			var delay time.Duration
+			if state.tokens < n {
+				if rl.maxRatePerMillisecond <= 0 {
+					reservation.ok = false
+					return state, false
+				}
+
+				delay = rl.timeUntilAvailable(state, n, now)
+			}
+
+			state.tokens -= n
+			reservation.ok = true
+			reservation.timeToAct = time.UnixMilli(int64(now)).Add(delay)
+			return state, true
+		})
+	}
+
+	if err != nil {
+		switch rl.failurePolicy {
+		case FailClosed:
+			reservation.ok = false
+		case FailLocal:
+			return rl.fallback.ReserveCtx(ctx, sourceKey, n)
+		default:
+			reservation.ok = true
+			reservation.timeToAct = rl.clock.Now()
+		}
+	}
+
+	return reservation
+}
@@ -0,0 +1,136 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	reservation := limiter.Reserve(sourceKey, 5)
+	if !reservation.OK() {
+		t.Fatalf("Expected reservation to be OK, but it wasn't")
+	}
+
+	if delay := reservation.Delay(); delay != 0 {
+		t.Errorf("Expected no delay, got %v", delay)
+	}
+
+	// Reserving 2 more tokens pushes the bucket into debt, which is paid back in 200 milliseconds
+	reservation = limiter.Reserve(sourceKey, 2)
+	if !reservation.OK() {
+		t.Fatalf("Expected reservation to be OK, but it wasn't")
+	}
+
+	if delay := reservation.Delay(); delay < 150*time.Millisecond || delay > 200*time.Millisecond {
+		t.Errorf("Expected a delay of around 200ms, got %v", delay)
+	}
+
+	// Events are denied while the bucket is in debt
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining tokens, got %d", 0, remaining)
+	}
+}
+
+func TestRateLimiter_Reserve_Keeps_Debt_Longer_Than_CacheTTL(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// the debt of the second reservation takes 20 seconds to pay back, longer than the default time-to-live of 10 seconds
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 1,
+		MaxBurst:         20,
+		Clock:            clock,
+	})
+
+	for i := 0; i < 2; i++ {
+		if reservation := limiter.Reserve(sourceKey, 20); !reservation.OK() {
+			t.Fatalf("Expected reservation to be OK, but it wasn't")
+		}
+	}
+
+	clock.Advance(11 * time.Second)
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining tokens, got %d", 0, remaining)
+	}
+
+	// the bucket is empty once the debt is paid back, and refills from there
+	clock.Advance(9 * time.Second)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+
+	clock.Advance(time.Second)
+	ratelimitertest.AssertAllowed(t, limiter, sourceKey)
+	ratelimitertest.AssertDenied(t, limiter, sourceKey)
+}
+
+func TestRateLimiter_Reserve_Exceeding_Burst_Is_Not_OK(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	reservation := limiter.Reserve(sourceKey, 6)
+	if reservation.OK() {
+		t.Errorf("Expected reservation not to be OK, but it was")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 5 {
+		t.Errorf("Expected %d remaining tokens, got %d", 5, remaining)
+	}
+}
+
+func TestRateLimiter_Reserve_Cancel_Gives_Unused_Tokens_Back(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	_ = limiter.Reserve(sourceKey, 5)
+
+	reservation := limiter.Reserve(sourceKey, 3)
+	reservation.Cancel()
+	reservation.Cancel()
+
+	// Only the first reservation is left, so the bucket is empty but not in debt
+	if delay := limiter.Reserve(sourceKey, 1).Delay(); delay > 100*time.Millisecond || delay < 50*time.Millisecond {
+		t.Errorf("Expected a delay of around 100ms, got %v", delay)
+	}
+}
+
+func TestRateLimiter_Reserve_Cancel_Does_Not_Give_Used_Tokens_Back(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+	}
+	limiter := ratelimiter.New(options)
+
+	reservation := limiter.Reserve(sourceKey, 5)
+	reservation.Cancel()
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining tokens, got %d", 0, remaining)
+	}
+}
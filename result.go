@@ -0,0 +1,53 @@
+package ratelimiter
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrRateLimited is matched by errors returned for events that were not allowed by the rate limiter.
+// Use errors.As with a *RateLimitedError to retrieve the time to wait before retrying.
+var ErrRateLimited = errors.New("ratelimiter: rate limited")
+
+// RateLimitedError represents an event that was not allowed by the rate limiter.
+type RateLimitedError struct {
+	RetryAfter time.Duration // The time until the event could be allowed.
+}
+
+// Error returns the error message, including the time to wait before retrying.
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter == time.Duration(math.MaxInt64) {
+		return ErrRateLimited.Error()
+	}
+
+	return ErrRateLimited.Error() + ", retry after " + e.RetryAfter.String()
+}
+
+// Is reports whether target is ErrRateLimited, so errors.Is can be used to check for rate limited events.
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Result represents the decision made by the rate limiter for an event, along with the bucket state after it.
+type Result struct {
+	Allowed    bool          // Whether the event was allowed.
+	Remaining  int           // The number of tokens remaining in the bucket.
+	Limit      int           // The number of events allowed in each period of the maximum rate.
+	ResetAfter time.Duration // The time until the bucket is full again.
+	ResetAt    time.Time     // The time when the bucket is full again. For FixedWindow, it is exactly the end of the current window.
+	RetryAfter time.Duration // The time until another event of the same cost could be allowed. Zero if it can be allowed right away.
+	Band       int           // The index of the bandwidth that bound the decision, when the limiter is configured with several bandwidths.
+	Level      int           // The level that bound the decision of a HierarchicalLimiter, starting with zero for the leaves.
+	Policy     Policy        // The policy applied to the decision, which is the one resolved for the key when the limiter has a PolicyResolver.
+	Banned     bool          // Whether the key is banned by the penalty of the limiter, in which case all its events are denied until RetryAfter elapses.
+}
+
+// Err returns a *RateLimitedError carrying the time to wait before retrying if the event was not allowed, or nil otherwise.
+func (r Result) Err() error {
+	if r.Allowed {
+		return nil
+	}
+
+	return &RateLimitedError{RetryAfter: r.RetryAfter}
+}
@@ -0,0 +1,36 @@
+package ratelimiter_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+)
+
+func TestResult_Err(t *testing.T) {
+	allowed := ratelimiter.Result{Allowed: true}
+	if err := allowed.Err(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	denied := ratelimiter.Result{Allowed: false, RetryAfter: 200 * time.Millisecond}
+
+	err := denied.Err()
+	if !errors.Is(err, ratelimiter.ErrRateLimited) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrRateLimited, err)
+	}
+
+	var rateLimitedErr *ratelimiter.RateLimitedError
+	if !errors.As(err, &rateLimitedErr) {
+		t.Fatalf("Expected error to be a *RateLimitedError, got %T", err)
+	}
+
+	if rateLimitedErr.RetryAfter != denied.RetryAfter {
+		t.Errorf("Expected retry after %v, got %v", denied.RetryAfter, rateLimitedErr.RetryAfter)
+	}
+
+	if message := err.Error(); message != "ratelimiter: rate limited, retry after 200ms" {
+		t.Errorf("Expected error message to include retry after, got %q", message)
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+// ErrQueueFull is returned when an event cannot be scheduled because the shaper queue is full.
+var ErrQueueFull = errors.New("ratelimiter: shaper queue is full")
+
+const departureKeyPrefix = "rl:departure:"
+
+// Shaper represents a traffic shaper that smooths the rate of events, implemented using a leaky bucket algorithm.
+// Instead of rejecting events over the rate, it schedules each admitted event to depart exactly 1/rate after the previous one, up to a bounded queue of delayed events.
+// The schedule is stored in the cache, so it is shared by all shapers using it.
+type Shaper struct {
+	limiter   *RateLimiter // The rate limiter holding the rate and the cache to store the schedule.
+	queueSize int          // The maximum number of events waiting for their departure.
+}
+
+func (s *Shaper) getDepartureKeyFor(sourceKey string) string {
+	return s.limiter.keys.keyFor(departureKeyPrefix, sourceKey)
+}
+
+// Schedule schedules an event for a particular key without blocking, and returns the delay before it can depart.
+// It returns ErrQueueFull if the queue is full, in which case the event is not scheduled.
+// If cache operations fail, the event can always depart right away.
+func (s *Shaper) Schedule(sourceKey string) (time.Duration, error) {
+	return s.ScheduleN(sourceKey, 1)
+}
+
+// ScheduleN schedules n events for a particular key without blocking, and returns the delay before the first of them can depart.
+// The events depart 1/rate apart from each other.
+// It returns ErrQueueFull if the queue has no room for all of them, in which case none of them is scheduled.
+// If cache operations fail, the events can always depart right away.
+func (s *Shaper) ScheduleN(sourceKey string, n int) (time.Duration, error) {
+	return s.schedule(context.Background(), sourceKey, n, time.Time{})
+}
+
+// Wait schedules an event for a particular key and blocks until it can depart.
+// It returns ErrQueueFull right away if the queue is full, ErrWaitExceedsDeadline right away if the context deadline would be exceeded before the departure,
+// or an error if the context is cancelled while waiting, in which case the departure slot is not given back.
+// Waiting sleeps on real time and ignores the clock of the shaper, so a fake clock only affects how departures are scheduled.
+func (s *Shaper) Wait(ctx context.Context, sourceKey string) error {
+	return s.WaitN(ctx, sourceKey, 1)
+}
+
+// WaitN schedules n events for a particular key and blocks until the first of them can depart.
+// It returns ErrQueueFull right away if the queue has no room for all of them, ErrWaitExceedsDeadline right away if the context deadline would be exceeded before the departure,
+// or an error if the context is cancelled while waiting, in which case the departure slots are not given back.
+// Waiting sleeps on real time and ignores the clock of the shaper, so a fake clock only affects how departures are scheduled.
+func (s *Shaper) WaitN(ctx context.Context, sourceKey string, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+
+	delay, err := s.schedule(ctx, sourceKey, n, deadline)
+	if err != nil {
+		return err
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// schedule advances the departure time for a particular key by n emission intervals, if there is room in the queue and the departure is not after the deadline.
+// A zero deadline means there is no deadline.
+func (s *Shaper) schedule(ctx context.Context, sourceKey string, n int, deadline time.Time) (time.Duration, error) {
+	rl := s.limiter
+	if rl.maxRatePerMillisecond <= 0 {
+		// events never depart at a zero rate
+		return 0, ErrQueueFull
+	}
+
+	if n <= 0 {
+		return 0, nil
+	}
+
+	now := int(rl.clock.Now().UnixMicro())
+	interval := rl.emissionInterval()
+
+	// the last event departs (n - 1) intervals after the first, and at most queueSize events can be waiting
+	queueCeiling := now + (s.queueSize+1)*interval
+	ceiling := queueCeiling
+	if !deadline.IsZero() {
+		// the first event must depart before the deadline
+		if deadlineCeiling := int(deadline.UnixMicro()) + n*interval; deadlineCeiling < ceiling {
+			ceiling = deadlineCeiling
+		}
+	}
+
+	next, scheduled, err := rl.advanceTimestamp(ctx, s.getDepartureKeyFor(sourceKey), now, n*interval, ceiling)
+	if err != nil {
+		// if cache fails, the queue is always empty. Let the event depart right away
+		return 0, nil
+	}
+
+	if !scheduled {
+		if next+n*interval > queueCeiling {
+			return 0, ErrQueueFull
+		}
+		return 0, ErrWaitExceedsDeadline
+	}
+
+	departure := next - n*interval
+	return time.Duration(departure-now) * time.Microsecond, nil
+}
+
+// ShaperOptions represents the options for configuring a Shaper.
+type ShaperOptions struct {
+	MaxRatePerSecond int                // The rate of events departing per second. Ignored if Rate is set.
+	Rate             Rate               // The rate of events departing, for rates that are not whole events per second, eg. Every(5*time.Second).
+	QueueSize        int                // The maximum number of events waiting for their departure. Zero means events are only admitted when they can depart right away.
+	Cache            cache.GetterSetter // The cache to store the schedule. If not provided, an in-memory cache will be used.
+	Clock            Clock              // The clock to read the current time from. Default is a monotonic clock.
+	Namespace        string             // Prefixes the cache keys of the shaper, so shapers with different rates can share a cache.
+	KeyBuilder       KeyBuilder         // Builds the cache keys from the namespace, the prefix of each kind of state and the source key. Default is DefaultKeyBuilder.
+}
+
+// NewShaper creates a new ready to use Shaper with the specified options.
+func NewShaper(options ShaperOptions) *Shaper {
+	return &Shaper{
+		limiter: New(Options{
+			MaxRatePerSecond: options.MaxRatePerSecond,
+			Rate:             options.Rate,
+			Cache:            options.Cache,
+			Clock:            options.Clock,
+			Namespace:        options.Namespace,
+			KeyBuilder:       options.KeyBuilder,
+		}),
+		queueSize: options.QueueSize,
+	}
+}
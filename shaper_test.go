@@ -0,0 +1,143 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestShaper_Schedule_Spaces_Events_At_The_Rate(t *testing.T) {
+	sourceKey := "test"
+
+	shaper := ratelimiter.NewShaper(ratelimiter.ShaperOptions{
+		MaxRatePerSecond: 10,
+		QueueSize:        3,
+	})
+
+	// Events depart 100 milliseconds apart
+	for i := 0; i < 4; i++ {
+		delay, err := shaper.Schedule(sourceKey)
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+
+		expected := time.Duration(i) * 100 * time.Millisecond
+		if delay > expected || delay < expected-10*time.Millisecond {
+			t.Errorf("Expected a delay of around %v, got %v", expected, delay)
+		}
+	}
+
+	// The queue is full with 3 delayed events
+	_, err := shaper.Schedule(sourceKey)
+	if !errors.Is(err, ratelimiter.ErrQueueFull) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrQueueFull, err)
+	}
+}
+
+func TestShaper_Schedule_Spaces_Events_At_High_Rates(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	rates := []struct {
+		rate     ratelimiter.Rate
+		interval time.Duration
+	}{
+		// the queue drains in less than the expiration resolution of caches
+		{rate: ratelimiter.Per(10000, time.Second), interval: 100 * time.Microsecond},
+		// events are scheduled with microsecond precision
+		{rate: ratelimiter.Per(2_000_000, time.Second), interval: time.Microsecond},
+	}
+
+	for _, tt := range rates {
+		shaper := ratelimiter.NewShaper(ratelimiter.ShaperOptions{
+			Rate:      tt.rate,
+			QueueSize: 2,
+			Clock:     clock,
+		})
+
+		for i := 0; i < 3; i++ {
+			delay, err := shaper.Schedule(sourceKey)
+			if expected := time.Duration(i) * tt.interval; err != nil || delay != expected {
+				t.Errorf("Rate %v: expected a delay of %v, got %v, %v", tt.rate, expected, delay, err)
+			}
+		}
+
+		if _, err := shaper.Schedule(sourceKey); !errors.Is(err, ratelimiter.ErrQueueFull) {
+			t.Errorf("Rate %v: expected error %v, got %v", tt.rate, ratelimiter.ErrQueueFull, err)
+		}
+	}
+}
+
+func TestShaper_ScheduleN_Does_Not_Schedule_Partially(t *testing.T) {
+	sourceKey := "test"
+
+	shaper := ratelimiter.NewShaper(ratelimiter.ShaperOptions{
+		MaxRatePerSecond: 10,
+		QueueSize:        2,
+	})
+
+	if _, err := shaper.ScheduleN(sourceKey, 4); !errors.Is(err, ratelimiter.ErrQueueFull) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrQueueFull, err)
+	}
+
+	delay, err := shaper.ScheduleN(sourceKey, 3)
+	if err != nil || delay != 0 {
+		t.Errorf("Expected events to be scheduled right away, got %v, %v", delay, err)
+	}
+}
+
+func TestShaper_Wait(t *testing.T) {
+	sourceKey := "test"
+
+	shaper := ratelimiter.NewShaper(ratelimiter.ShaperOptions{
+		MaxRatePerSecond: 20,
+		QueueSize:        5,
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := shaper.Wait(context.Background(), sourceKey); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+
+	// The third event departs 2 intervals of 50 milliseconds after the first
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("Expected to wait around 100ms, but waited %v", elapsed)
+	}
+}
+
+func TestShaper_Wait_Fails_Right_Away_If_Deadline_Is_Too_Soon(t *testing.T) {
+	sourceKey := "test"
+
+	shaper := ratelimiter.NewShaper(ratelimiter.ShaperOptions{
+		MaxRatePerSecond: 1,
+		QueueSize:        5,
+	})
+
+	_ = shaper.Wait(context.Background(), sourceKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := shaper.Wait(ctx, sourceKey)
+	if !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected error %v, got %v", ratelimiter.ErrWaitExceedsDeadline, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected to fail right away, but waited %v", elapsed)
+	}
+
+	// The slot was not taken, so the next event departs 1 second after the first
+	delay, _ := shaper.Schedule(sourceKey)
+	if delay > time.Second || delay < 900*time.Millisecond {
+		t.Errorf("Expected a delay of around 1s, got %v", delay)
+	}
+}
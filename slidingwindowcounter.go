@@ -0,0 +1,233 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const windowKeyPrefix = "rl:window:"
+
+func (rl *RateLimiter) getWindowKeyFor(sourceKey string, window int) string {
+	return rl.keys.keyFor(windowKeyPrefix, sourceKey+":"+strconv.Itoa(window))
+}
+
+// countWindowMilliseconds returns the length in milliseconds of the windows whose events are counted by the FixedWindow and SlidingWindowCounter algorithms.
+// If the rate is zero, the window is infinite.
+func (rl *RateLimiter) countWindowMilliseconds() int {
+	if rl.maxRatePerMillisecond <= 0 {
+		return math.MaxInt
+	}
+
+	return rl.countWindow
+}
+
+// countWindowLimit returns the number of events allowed in each counted window, which is the number of events the rate allows in it, up to the maximum burst.
+func (rl *RateLimiter) countWindowLimit() int {
+	if rl.maxRatePerMillisecond <= 0 {
+		return 0
+	}
+
+	if limit := math.Round(rl.maxRatePerMillisecond * float64(rl.countWindow)); limit < float64(rl.maxBurst) {
+		return int(limit)
+	}
+
+	return rl.maxBurst
+}
+
+// exceedsBurst reports if an event costing n tokens can never be allowed.
+// Counted windows can't hold more events than their limit, which is lower than the maximum burst at low rates.
+func (rl *RateLimiter) exceedsBurst(n int) bool {
+	if (rl.algorithm == SlidingWindowCounter || rl.algorithm == FixedWindow) && rl.maxRatePerMillisecond > 0 {
+		return n > rl.countWindowLimit()
+	}
+
+	return n > rl.maxBurst
+}
+
+// resizeCountWindow sizes counted windows for the current rate and burst, if they can't count any events at their current length.
+// Otherwise, windows keep their length, since changing it would move the events already counted to other windows.
+// It must be called with the lock held.
+func (rl *RateLimiter) resizeCountWindow() {
+	if rl.countWindow == math.MaxInt || rl.countWindowLimit() < 1 {
+		rl.countWindow = rl.windowMilliseconds()
+	}
+}
+
+// windowState represents the event counts stored in the cache for the current and previous windows of a source key.
+type windowState struct {
+	window   int // The index of the current window, counted in window lengths since the Unix epoch.
+	current  int // The number of events in the current window.
+	previous int // The number of events in the previous window.
+}
+
+// getWindowStateFor retrieves the event counts for the window containing now and the one before it.
+// Cache misses are returned as zero counts.
+func (rl *RateLimiter) getWindowStateFor(ctx context.Context, sourceKey string, now int) (windowState, error) {
+	c := rl.cacheFor(ctx)
+
+	window := now / rl.countWindowMilliseconds()
+
+	current, err := c.Get(rl.getWindowKeyFor(sourceKey, window))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return windowState{}, err
+	}
+
+	previous, err := c.Get(rl.getWindowKeyFor(sourceKey, window-1))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return windowState{}, err
+	}
+
+	return windowState{window: window, current: current, previous: previous}, nil
+}
+
+// setWindowCountFor stores the updated count for the current window, which must outlive the next window to be weighted in it.
+// If the cache supports compare-and-swap, the count is only stored if it still matches the stored count, and the result reports whether it was stored.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setWindowCountFor(ctx context.Context, sourceKey string, stored windowState, count int) (bool, error) {
+	c := rl.cacheFor(ctx)
+
+	key := rl.getWindowKeyFor(sourceKey, stored.window)
+	expiration := 2 * time.Duration(rl.countWindowMilliseconds()) * time.Millisecond
+
+	if cas, ok := c.(cache.CompareAndSwapper); ok {
+		return cas.CompareAndSwap([]string{key}, []int{stored.current}, []int{count}, expiration)
+	}
+
+	return true, c.SetWithExpiration(key, count, expiration)
+}
+
+// estimateWindowCount approximates the number of events in the sliding window ending now, weighting the previous window by how much of it overlaps the sliding window.
+func (rl *RateLimiter) estimateWindowCount(state windowState, now int) float64 {
+	window := rl.countWindowMilliseconds()
+	elapsed := now - state.window*window
+
+	return float64(state.previous)*(1-float64(elapsed)/float64(window)) + float64(state.current)
+}
+
+// takeFromWindowCounter counts n events for a particular key if the estimated number of events in the sliding window leaves room for them.
+// If the cache implements [cache.CompareAndSwapper], the events are counted atomically.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) takeFromWindowCounter(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		// an infinite window never lets events expire
+		return Result{Limit: rl.rate.Events, RetryAfter: time.Duration(math.MaxInt64)}, nil
+	}
+
+	for {
+		now := int(rl.clock.Now().UnixMilli())
+
+		stored, err := rl.getWindowStateFor(ctx, sourceKey, now)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if rl.estimateWindowCount(stored, now)+float64(n) > float64(rl.countWindowLimit()) {
+			return rl.windowCounterResultFor(stored, n, now, false), nil
+		}
+
+		swapped, err := rl.setWindowCountFor(ctx, sourceKey, stored, stored.current+n)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if swapped {
+			state := stored
+			state.current += n
+			return rl.windowCounterResultFor(state, n, now, true), nil
+		}
+		// the window was changed by a concurrent caller, try again with the updated count
+	}
+}
+
+// windowCounterResultFor builds the result of a decision for an event costing n tokens, given the window state after it.
+func (rl *RateLimiter) windowCounterResultFor(state windowState, n int, now int, allowed bool) Result {
+	window := rl.countWindowMilliseconds()
+	windowEnd := (state.window + 1) * window
+	limit := rl.countWindowLimit()
+	available := float64(limit) - rl.estimateWindowCount(state, now)
+
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(available))),
+		Limit:     rl.rate.Events,
+	}
+
+	// events in the current window are weighted until the end of the next one
+	if state.current > 0 {
+		result.ResetAfter = time.Duration(windowEnd+window-now) * time.Millisecond
+	} else if state.previous > 0 {
+		result.ResetAfter = time.Duration(windowEnd-now) * time.Millisecond
+	}
+
+	if available >= float64(n) {
+		return result
+	}
+
+	room := float64(limit - n)
+	var retryAt float64
+	if room < 0 {
+		// the event is larger than the window limit and can never be allowed
+		result.RetryAfter = time.Duration(math.MaxInt64)
+		return result
+	} else if float64(state.current) <= room {
+		// the previous window weight must drop enough within the current window
+		retryAt = float64(state.window*window) + float64(window)*(1-(room-float64(state.current))/float64(state.previous))
+	} else {
+		// the current window becomes the previous one and its weight must drop enough within the next window
+		retryAt = float64(windowEnd) + float64(window)*(1-room/float64(state.current))
+	}
+
+	result.RetryAfter = time.Duration(math.Ceil(retryAt)-float64(now)) * time.Millisecond
+	if result.RetryAfter < time.Millisecond {
+		result.RetryAfter = time.Millisecond
+	}
+
+	return result
+}
+
+// remainingInWindowCounter returns the estimated number of events that can still be counted for a particular key in the sliding window.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingInWindowCounter(ctx context.Context, sourceKey string) (int, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		return 0, nil
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+
+	state, err := rl.getWindowStateFor(ctx, sourceKey, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return rl.windowCounterResultFor(state, 0, now, true).Remaining, nil
+}
+
+// setWindowCounterTokens stores counts for a particular key that leave the given tokens in the sliding window, clearing the previous window.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setWindowCounterTokens(ctx context.Context, sourceKey string, tokens int) error {
+	if rl.maxRatePerMillisecond <= 0 {
+		return nil
+	}
+
+	c := rl.cacheFor(ctx)
+
+	window := int(rl.clock.Now().UnixMilli()) / rl.countWindowMilliseconds()
+	expiration := 2 * time.Duration(rl.countWindowMilliseconds()) * time.Millisecond
+
+	// windows kept across a slower rate allow fewer events than the burst
+	limit := rl.countWindowLimit()
+	if tokens > limit {
+		tokens = limit
+	}
+
+	if err := c.SetWithExpiration(rl.getWindowKeyFor(sourceKey, window-1), 0, expiration); err != nil {
+		return err
+	}
+
+	return c.SetWithExpiration(rl.getWindowKeyFor(sourceKey, window), limit-tokens, expiration)
+}
@@ -0,0 +1,125 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_SlidingWindowCounter_Allow(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// about 5 events in any 500 milliseconds window
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.SlidingWindowCounter,
+		Clock:            clock,
+	}
+	limiter := ratelimiter.New(options)
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining events, got %d", 0, remaining)
+	}
+
+	// Events are no longer weighted after two full windows
+	clock.Advance(time.Second)
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+}
+
+func TestRateLimiter_SlidingWindowCounter_Windows_Last_At_Least_A_Millisecond(t *testing.T) {
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// a full burst takes half a millisecond
+	limiter := ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10000,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.SlidingWindowCounter,
+		Clock:            clock,
+	})
+
+	ratelimitertest.AssertAllowedN(t, limiter, "test", 5)
+	ratelimitertest.AssertDenied(t, limiter, "test")
+
+	clock.Advance(2 * time.Millisecond)
+	ratelimitertest.AssertAllowed(t, limiter, "test")
+
+	// a zero burst never allows events
+	limiter = ratelimiter.New(ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		Algorithm:        ratelimiter.SlidingWindowCounter,
+		Clock:            clock,
+	})
+
+	if remaining := limiter.Remaining("test"); remaining != 0 {
+		t.Errorf("Expected %d remaining events, got %d", 0, remaining)
+	}
+
+	if limiter.Allow("test") {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+}
+
+func TestRateLimiter_SlidingWindowCounter_Works_With_Any_Cache(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.SlidingWindowCounter,
+		Cache:            &mockGetterSetterCache{values: map[string]int{}},
+	}
+	limiter := ratelimiter.New(options)
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	result, _ := limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected to retry within two windows, got %v", result.RetryAfter)
+	}
+}
+
+// mockGetterSetterCache is a mock implementation of the cache.GetterSetter interface without any optional capabilities.
+type mockGetterSetterCache struct {
+	values map[string]int
+}
+
+func (c *mockGetterSetterCache) Get(key string) (int, error) {
+	return c.values[key], nil
+}
+
+func (c *mockGetterSetterCache) Set(key string, value int) error {
+	c.values[key] = value
+	return nil
+}
+
+func (c *mockGetterSetterCache) SetWithExpiration(key string, value int, expiration time.Duration) error {
+	c.values[key] = value
+	return nil
+}
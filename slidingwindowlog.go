@@ -0,0 +1,139 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const logKeyPrefix = "rl:log:"
+
+func (rl *RateLimiter) getLogKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(logKeyPrefix, sourceKey)
+}
+
+// windowMilliseconds returns the length of the sliding window in milliseconds, in which at most maxBurst events are allowed.
+// If the rate is zero, the window is infinite. Windows last at least a millisecond, even if a full burst takes less or the burst is zero.
+func (rl *RateLimiter) windowMilliseconds() int {
+	if rl.maxRatePerMillisecond <= 0 {
+		return math.MaxInt
+	}
+
+	if window := int(rl.rate.TimeFor(rl.maxBurst).Milliseconds()); window > 0 {
+		return window
+	}
+
+	return 1
+}
+
+// logExpiration returns the expiration for event logs, which must last at least a full window.
+func (rl *RateLimiter) logExpiration() time.Duration {
+	window := time.Duration(rl.windowMilliseconds()) * time.Millisecond
+	if rl.maxRatePerMillisecond <= 0 || window < rl.cacheTTL {
+		return rl.cacheTTL
+	}
+
+	return window
+}
+
+// takeFromLog logs n events for a particular key if there are fewer than maxBurst events in the current window.
+// It returns an error if cache operations fail, or ErrUnsupportedCache if the cache does not implement [cache.EventLogger].
+func (rl *RateLimiter) takeFromLog(ctx context.Context, sourceKey string, n int) (Result, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		// an infinite window never lets events expire
+		return Result{Limit: rl.rate.Events, RetryAfter: time.Duration(math.MaxInt64)}, nil
+	}
+
+	logger, ok := rl.cacheFor(ctx).(cache.EventLogger)
+	if !ok {
+		return Result{}, ErrUnsupportedCache
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+	window := rl.windowMilliseconds()
+
+	logged, timestamps, err := logger.LogEvents(rl.getLogKeyFor(sourceKey), now-window+1, now, n, rl.maxBurst, rl.logExpiration())
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   logged,
+		Remaining: rl.maxBurst - len(timestamps),
+		Limit:     rl.rate.Events,
+	}
+
+	if len(timestamps) > 0 {
+		result.ResetAfter = time.Duration(timestamps[len(timestamps)-1]+window-now) * time.Millisecond
+	}
+
+	if result.Remaining < n {
+		// the oldest events must leave the window to make room for n more
+		oldest := timestamps[len(timestamps)-rl.maxBurst+n-1]
+		result.RetryAfter = time.Duration(oldest+window-now) * time.Millisecond
+	}
+
+	if result.Remaining < 0 {
+		// the log holds more events than the burst after it was lowered
+		result.Remaining = 0
+	}
+
+	return result, nil
+}
+
+// remainingInLog returns the number of events that can still be logged for a particular key in the current window.
+// It returns an error if cache operations fail, or ErrUnsupportedCache if the cache does not implement [cache.EventLogger].
+func (rl *RateLimiter) remainingInLog(ctx context.Context, sourceKey string) (int, error) {
+	if rl.maxRatePerMillisecond <= 0 {
+		return 0, nil
+	}
+
+	logger, ok := rl.cacheFor(ctx).(cache.EventLogger)
+	if !ok {
+		return 0, ErrUnsupportedCache
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+
+	timestamps, err := logger.EventLog(rl.getLogKeyFor(sourceKey), now-rl.windowMilliseconds()+1)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(timestamps) > rl.maxBurst {
+		return 0, nil
+	}
+
+	return rl.maxBurst - len(timestamps), nil
+}
+
+// setLogTokens replaces the log for a particular key with enough events at now to leave the given tokens in the current window.
+// It returns an error if cache operations fail, or ErrUnsupportedCache if the cache does not implement [cache.EventLogger] and [cache.Deleter].
+func (rl *RateLimiter) setLogTokens(ctx context.Context, sourceKey string, tokens int) error {
+	if rl.maxRatePerMillisecond <= 0 {
+		return nil
+	}
+
+	c := rl.cacheFor(ctx)
+
+	logger, ok := c.(cache.EventLogger)
+	if !ok {
+		return ErrUnsupportedCache
+	}
+
+	deleter, ok := c.(cache.Deleter)
+	if !ok {
+		return ErrUnsupportedCache
+	}
+
+	key := rl.getLogKeyFor(sourceKey)
+	if err := deleter.Delete(key); err != nil {
+		return err
+	}
+
+	now := int(rl.clock.Now().UnixMilli())
+	_, _, err := logger.LogEvents(key, now-rl.windowMilliseconds()+1, now, rl.maxBurst-tokens, rl.maxBurst, rl.logExpiration())
+	return err
+}
@@ -0,0 +1,97 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter"
+	"github.com/rcdmk/go-ratelimiter/ratelimitertest"
+)
+
+func TestRateLimiter_SlidingWindowLog_Allow(t *testing.T) {
+	sourceKey := "test"
+
+	clock := ratelimitertest.NewClock(time.Time{})
+
+	// 5 events in any 500 milliseconds window
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.SlidingWindowLog,
+		Clock:            clock,
+	}
+	limiter := ratelimiter.New(options)
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+
+	// A token bucket would have refilled some tokens by now, but the window is still full
+	clock.Advance(250 * time.Millisecond)
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if remaining := limiter.Remaining(sourceKey); remaining != 0 {
+		t.Errorf("Expected %d remaining events, got %d", 0, remaining)
+	}
+
+	// The first events left the window
+	clock.Advance(249 * time.Millisecond)
+	if limiter.Allow(sourceKey) {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	clock.Advance(time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow(sourceKey) {
+			t.Errorf("Expected limiter to allow event, but it didn't")
+		}
+	}
+}
+
+func TestRateLimiter_SlidingWindowLog_Decide(t *testing.T) {
+	sourceKey := "test"
+
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         2,
+		Algorithm:        ratelimiter.SlidingWindowLog,
+	}
+	limiter := ratelimiter.New(options)
+
+	result, _ := limiter.Decide(sourceKey)
+	if !result.Allowed || result.Remaining != 1 || result.RetryAfter != 0 {
+		t.Errorf("Expected event to be allowed with 1 remaining event, got %+v", result)
+	}
+
+	if result.ResetAfter <= 150*time.Millisecond || result.ResetAfter > 200*time.Millisecond {
+		t.Errorf("Expected window to be empty within 200ms, got %v", result.ResetAfter)
+	}
+
+	_, _ = limiter.Decide(sourceKey)
+
+	result, _ = limiter.Decide(sourceKey)
+	if result.Allowed {
+		t.Errorf("Expected limiter to rate-limit event, but it didn't")
+	}
+
+	if result.RetryAfter <= 150*time.Millisecond || result.RetryAfter > 200*time.Millisecond {
+		t.Errorf("Expected first event to leave the window within 200ms, got %v", result.RetryAfter)
+	}
+}
+
+func TestRateLimiter_SlidingWindowLog_Reserve_Is_Not_Supported(t *testing.T) {
+	options := ratelimiter.Options{
+		MaxRatePerSecond: 10,
+		MaxBurst:         5,
+		Algorithm:        ratelimiter.SlidingWindowLog,
+	}
+	limiter := ratelimiter.New(options)
+
+	if limiter.Reserve("test", 1).OK() {
+		t.Errorf("Expected reservation not to be OK, but it was")
+	}
+}
@@ -0,0 +1,237 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rcdmk/go-ratelimiter/cache"
+)
+
+const (
+	bucketKeyPrefix   = "rl:bucket:"
+	lastFillKeyPrefix = "rl:fill:"
+)
+
+// bucketState represents the token bucket values stored in the cache for a source key.
+type bucketState struct {
+	tokens   int // The number of tokens available in the bucket.
+	lastFill int // Unix time in milliseconds up to which elapsed time was turned into tokens.
+}
+
+func (rl *RateLimiter) getBucketKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(bucketKeyPrefix, sourceKey)
+}
+
+func (rl *RateLimiter) getLastFillKeyFor(sourceKey string) string {
+	return rl.keys.keyFor(lastFillKeyPrefix, sourceKey)
+}
+
+// getStateFor retrieves the stored bucket state for a particular key.
+// Cache misses are returned as zero values, which results in a full bucket once filled.
+func (rl *RateLimiter) getStateFor(ctx context.Context, sourceKey string) (bucketState, error) {
+	c := rl.cacheFor(ctx)
+
+	bucket, err := c.Get(rl.getBucketKeyFor(sourceKey))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return bucketState{}, err
+	}
+
+	lastFill, err := c.Get(rl.getLastFillKeyFor(sourceKey))
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		return bucketState{}, err
+	}
+
+	return bucketState{tokens: bucket, lastFill: lastFill}, nil
+}
+
+// bucketExpiration returns the time-to-live for a bucket state stored at now, which lasts at least until an empty bucket is full again, so slow rates don't get a full bucket back early.
+// Buckets in debt from reservations are kept until the debt is paid back and the bucket is full again.
+// It follows the current rate and burst, so it changes along with them.
+func (rl *RateLimiter) bucketExpiration(state bucketState, now int) time.Duration {
+	expiration := rl.cacheTTL
+	if rl.maxRatePerMillisecond <= 0 {
+		return expiration
+	}
+
+	if refill := rl.rate.TimeFor(rl.maxBurst); refill > expiration {
+		expiration = refill
+	}
+
+	if state.tokens < rl.maxBurst {
+		if refill := rl.timeUntilAvailable(state, rl.maxBurst, now); refill > expiration {
+			expiration = refill
+		}
+	}
+
+	return expiration
+}
+
+// setStateFor stores the updated bucket state for a particular key.
+// If the cache supports compare-and-swap, the state is only stored if it still matches the previously stored state, and the result reports whether it was stored.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setStateFor(ctx context.Context, sourceKey string, stored, updated bucketState) (bool, error) {
+	c := rl.cacheFor(ctx)
+
+	bucketKey := rl.getBucketKeyFor(sourceKey)
+	lastFillKey := rl.getLastFillKeyFor(sourceKey)
+	expiration := rl.bucketExpiration(updated, int(rl.clock.Now().UnixMilli()))
+
+	if cas, ok := c.(cache.CompareAndSwapper); ok {
+		return cas.CompareAndSwap(
+			[]string{bucketKey, lastFillKey},
+			[]int{stored.tokens, stored.lastFill},
+			[]int{updated.tokens, updated.lastFill},
+			expiration,
+		)
+	}
+
+	if err := c.SetWithExpiration(bucketKey, updated.tokens, expiration); err != nil {
+		return false, err
+	}
+
+	return true, c.SetWithExpiration(lastFillKey, updated.lastFill, expiration)
+}
+
+// fillBucket fills the bucket with tokens based on the elapsed time since the last fill.
+// The last fill time only advances by the time turned into whole tokens, so partial progress towards the next token is kept between calls.
+func (rl *RateLimiter) fillBucket(state bucketState, now int) bucketState {
+	elapsed := now - state.lastFill
+
+	// important to use floating points for partial bucket filling, eg. 10 tokens per second = 1 token per 0.1 seconds
+	newTokens := int(float64(elapsed) * rl.maxRatePerMillisecond)
+
+	bucket := state.tokens + newTokens
+
+	if bucket >= rl.maxBurst {
+		// a full bucket makes no progress towards the next token
+		return bucketState{tokens: rl.maxBurst, lastFill: now}
+	}
+
+	if newTokens <= 0 {
+		return state
+	}
+
+	// rounding up never credits more time than the tokens took, which would let the rate creep up
+	lastFill := state.lastFill + int(math.Ceil(float64(newTokens)/rl.maxRatePerMillisecond))
+	if lastFill > now {
+		lastFill = now
+	}
+
+	return bucketState{tokens: bucket, lastFill: lastFill}
+}
+
+// remainingInBucket returns the number of tokens available in the bucket for a particular key without consuming them.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) remainingInBucket(ctx context.Context, sourceKey string) (int, error) {
+	state, err := rl.getStateFor(ctx, sourceKey)
+	if err != nil {
+		return 0, err
+	}
+
+	tokens := rl.fillBucket(state, int(rl.clock.Now().UnixMilli())).tokens
+	if tokens < 0 {
+		// the bucket is in debt because of reservations
+		return 0, nil
+	}
+
+	return tokens, nil
+}
+
+// takeFromBucket consumes n tokens from the bucket for a particular key if they are all available.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) takeFromBucket(ctx context.Context, sourceKey string, n int) (Result, error) {
+	var result Result
+
+	err := rl.updateStateFor(ctx, sourceKey, func(stored bucketState, now int) (bucketState, bool) {
+		state := rl.fillBucket(stored, now)
+		if state.tokens < n {
+			result = rl.resultFor(state, n, now, false)
+			result.RetryAfter = rl.timeUntilAvailable(stored, n, now)
+			return state, false
+		}
+
+		state.tokens -= n
+		result = rl.resultFor(state, n, now, true)
+		return state, true
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// resultFor builds the result of a decision for an event costing n tokens, given the bucket state after it.
+func (rl *RateLimiter) resultFor(state bucketState, n int, now int, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: state.tokens,
+		Limit:     rl.rate.Events,
+	}
+
+	if result.Remaining < 0 {
+		// the bucket is in debt because of reservations
+		result.Remaining = 0
+	}
+
+	if state.tokens < rl.maxBurst {
+		result.ResetAfter = rl.timeUntilAvailable(state, rl.maxBurst, now)
+	}
+
+	if state.tokens < n {
+		result.RetryAfter = rl.timeUntilAvailable(state, n, now)
+	}
+
+	return result
+}
+
+// updateStateFor applies update to the bucket state for a particular key and stores the result if requested.
+// update receives the stored state and the current Unix time in milliseconds, and returns the updated state and whether it should be stored.
+// If the bucket was changed by a concurrent caller, update is called again with the new stored state.
+// It returns an error if cache operations fail, in which case the state is not stored.
+func (rl *RateLimiter) updateStateFor(ctx context.Context, sourceKey string, update func(stored bucketState, now int) (bucketState, bool)) error {
+	for {
+		stored, err := rl.getStateFor(ctx, sourceKey)
+		if err != nil {
+			return err
+		}
+
+		updated, store := update(stored, int(rl.clock.Now().UnixMilli()))
+		if !store {
+			return nil
+		}
+
+		swapped, err := rl.setStateFor(ctx, sourceKey, stored, updated)
+		if err != nil || swapped {
+			return err
+		}
+		// the bucket was changed by a concurrent caller, try again with the updated state
+	}
+}
+
+// timeUntilAvailable calculates the time from now until a bucket that is currently short of n tokens has them, based on the stored state.
+// If the rate is zero, the tokens will never be available and the maximum duration is returned.
+func (rl *RateLimiter) timeUntilAvailable(stored bucketState, n int, now int) time.Duration {
+	if rl.maxRatePerMillisecond <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	elapsed := int(math.Ceil(float64(n-stored.tokens) / rl.maxRatePerMillisecond))
+	wait := stored.lastFill + elapsed - now
+	if wait < 1 {
+		// floating point rounding can leave the bucket short right at the boundary, retry on the next millisecond
+		wait = 1
+	}
+
+	return time.Duration(wait) * time.Millisecond
+}
+
+// setBucketTokens stores a bucket holding the given tokens for a particular key, filled up to now.
+// It returns an error if cache operations fail.
+func (rl *RateLimiter) setBucketTokens(ctx context.Context, sourceKey string, tokens int) error {
+	return rl.updateStateFor(ctx, sourceKey, func(_ bucketState, now int) (bucketState, bool) {
+		return bucketState{tokens: tokens, lastFill: now}, true
+	})
+}